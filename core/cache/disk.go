@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"chatgpt-adapter/core/logger"
+	"github.com/eko/gocache/lib/v4/store"
+	bolt "go.etcd.io/bbolt"
+)
+
+const DiskType = "disk"
+
+var diskBucket = []byte("cache")
+
+// 基于 bbolt 的本地持久化存储，重启后数据仍然有效。
+// 每条记录前 8 字节为过期时间（unix 纳秒，0 表示不过期）
+type DiskStore struct {
+	db *bolt.DB
+}
+
+func NewDiskStore(path string, cleanup time.Duration) (*DiskStore, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, e := tx.CreateBucketIfNotExists(diskBucket)
+		return e
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	s := &DiskStore{db}
+	if cleanup > 0 {
+		go s.cleanup(cleanup)
+	}
+	return s, nil
+}
+
+func (s *DiskStore) Get(ctx context.Context, key any) (any, error) {
+	value, _, err := s.GetWithTTL(ctx, key)
+	return value, err
+}
+
+func (s *DiskStore) GetWithTTL(_ context.Context, key any) (value any, ttl time.Duration, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(diskBucket).Get([]byte(fmt.Sprint(key)))
+		if len(data) < 8 {
+			return store.NotFoundWithCause(nil)
+		}
+
+		if expire := int64(binary.BigEndian.Uint64(data)); expire > 0 {
+			ttl = time.Until(time.Unix(0, expire))
+			if ttl <= 0 {
+				return store.NotFoundWithCause(nil)
+			}
+		}
+
+		// bbolt 返回的切片只在事务内有效
+		value = append([]byte(nil), data[8:]...)
+		return nil
+	})
+	return
+}
+
+func (s *DiskStore) Set(_ context.Context, key any, value any, options ...store.Option) error {
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("disk store: unsupported value type %T", value)
+	}
+
+	var expire int64
+	if opts := store.ApplyOptions(options...); opts.Expiration > 0 {
+		expire = time.Now().Add(opts.Expiration).UnixNano()
+	}
+
+	buffer := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint64(buffer, uint64(expire))
+	buffer = append(buffer, data...)
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(diskBucket).Put([]byte(fmt.Sprint(key)), buffer)
+	})
+}
+
+func (s *DiskStore) Delete(_ context.Context, key any) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(diskBucket).Delete([]byte(fmt.Sprint(key)))
+	})
+}
+
+func (s *DiskStore) Invalidate(context.Context, ...store.InvalidateOption) error {
+	return nil
+}
+
+func (s *DiskStore) Clear(context.Context) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(diskBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(diskBucket)
+		return err
+	})
+}
+
+func (s *DiskStore) GetType() string {
+	return DiskType
+}
+
+func (s *DiskStore) Close() error {
+	return s.db.Close()
+}
+
+// 定时清理过期记录
+func (s *DiskStore) cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		now := time.Now().UnixNano()
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			cursor := tx.Bucket(diskBucket).Cursor()
+			for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+				if len(v) < 8 {
+					continue
+				}
+				if expire := int64(binary.BigEndian.Uint64(v)); expire > 0 && expire < now {
+					if err := cursor.Delete(); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		if err == bolt.ErrDatabaseNotOpen {
+			return
+		}
+		if err != nil {
+			logger.Warnf("disk cache cleanup failed: %v", err)
+		}
+	}
+}
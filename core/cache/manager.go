@@ -0,0 +1,239 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/logger"
+	"github.com/eko/gocache/lib/v4/store"
+	"github.com/iocgo/sdk/env"
+	"github.com/redis/go-redis/v9"
+
+	gocacheStore "github.com/eko/gocache/store/go_cache/v4"
+	redisStore "github.com/eko/gocache/store/redis/v4"
+	gocache "github.com/patrickmn/go-cache"
+)
+
+const (
+	MemoryType = "memory"
+	RedisType  = "redis"
+)
+
+// 缓存配置：
+//
+//	cache:
+//	  type: memory            # memory / disk / redis
+//	  disk:
+//	    path: data/cache.db
+//	  redis:
+//	    addr: 127.0.0.1:6379
+//	    password: ""
+//	    db: 0
+//	    prefix: chatgpt-adapter:
+//	  ttl:                    # SetValue 使用的各管理器默认过期时间
+//	    tool-tasks: 120s
+//	    windsurf: 1h
+//	    bing: 1h
+//	    cursor: 30m
+//	    response: 10m
+//	    summary: 1h
+type Manager[T any] struct {
+	name  string
+	ttl   time.Duration
+	store store.StoreInterface
+	// 非内存存储中以 JSON 保存
+	encoded bool
+}
+
+var (
+	toolTasksCacheManager *Manager[[]model.Keyv[string]]
+	windsurfCacheManager  *Manager[string]
+	bingCacheManager      *Manager[string]
+	cursorCacheManager    *Manager[string]
+	responseCacheManager  *Manager[string]
+	summaryCacheManager   *Manager[string]
+
+	// 共享存储中的键前缀，避免与其它应用冲突
+	prefix = "chatgpt-adapter:"
+)
+
+var defaultTTLs = map[string]time.Duration{
+	"tool-tasks": 120 * time.Second,
+	"windsurf":   time.Hour,
+	"bing":       time.Hour,
+	"cursor":     30 * time.Minute,
+	"response":   10 * time.Minute,
+	"summary":    time.Hour,
+}
+
+func init() {
+	inited.AddInitialized(func(env *env.Environment) {
+		newStore, err := storeBuilder(env)
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		toolTasksCacheManager = newManager[[]model.Keyv[string]](env, "tool-tasks", newStore)
+		windsurfCacheManager = newManager[string](env, "windsurf", newStore)
+		bingCacheManager = newManager[string](env, "bing", newStore)
+		cursorCacheManager = newManager[string](env, "cursor", newStore)
+		responseCacheManager = newManager[string](env, "response", newStore)
+		summaryCacheManager = newManager[string](env, "summary", newStore)
+	})
+}
+
+// 按 cache.type 创建存储；内存存储每个管理器独立，磁盘与 redis 共享同一连接并以名称作为键前缀
+func storeBuilder(environment *env.Environment) (func() store.StoreInterface, error) {
+	cacheType := environment.GetString("cache.type")
+	switch cacheType {
+	case "", MemoryType:
+		return func() store.StoreInterface {
+			return gocacheStore.NewGoCache(gocache.New(5*time.Minute, 5*time.Minute))
+		}, nil
+
+	case DiskType:
+		path := environment.GetString("cache.disk.path")
+		if path == "" {
+			path = "data/cache.db"
+		}
+		diskStore, err := NewDiskStore(path, 5*time.Minute)
+		if err != nil {
+			return nil, fmt.Errorf("open disk cache '%s' failed: %v", path, err)
+		}
+		inited.AddExited(func(*env.Environment) { _ = diskStore.Close() })
+		logger.Infof("cache store: disk, path: %s", path)
+		return func() store.StoreInterface { return diskStore }, nil
+
+	case RedisType:
+		client := redis.NewClient(&redis.Options{
+			Addr:     environment.GetString("cache.redis.addr"),
+			Password: environment.GetString("cache.redis.password"),
+			DB:       environment.GetInt("cache.redis.db"),
+		})
+
+		timeout, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := client.Ping(timeout).Err(); err != nil {
+			return nil, fmt.Errorf("connect redis cache '%s' failed: %v", client.Options().Addr, err)
+		}
+		inited.AddExited(func(*env.Environment) { _ = client.Close() })
+		if environment.IsSet("cache.redis.prefix") {
+			prefix = environment.GetString("cache.redis.prefix")
+		}
+		logger.Infof("cache store: redis, addr: %s", client.Options().Addr)
+
+		redisS := redisStore.NewRedis(client)
+		return func() store.StoreInterface { return redisS }, nil
+
+	default:
+		return nil, fmt.Errorf("unknown cache type: %s", cacheType)
+	}
+}
+
+func newManager[T any](env *env.Environment, name string, newStore func() store.StoreInterface) *Manager[T] {
+	ttl := defaultTTLs[name]
+	if value := env.GetDuration("cache.ttl." + name); value > 0 {
+		ttl = value
+	}
+
+	s := newStore()
+	return &Manager[T]{
+		name:    name,
+		ttl:     ttl,
+		store:   s,
+		encoded: s.GetType() != gocacheStore.GoCacheType,
+	}
+}
+
+func ToolTasksCacheManager() *Manager[[]model.Keyv[string]] {
+	return toolTasksCacheManager
+}
+
+func WindsurfCacheManager() *Manager[string] {
+	return windsurfCacheManager
+}
+
+func BingCacheManager() *Manager[string] {
+	return bingCacheManager
+}
+
+func CursorCacheManager() *Manager[string] {
+	return cursorCacheManager
+}
+
+func ResponseCacheManager() *Manager[string] {
+	return responseCacheManager
+}
+
+func SummaryCacheManager() *Manager[string] {
+	return summaryCacheManager
+}
+
+func (cacheManager *Manager[T]) key(key string) string {
+	if !cacheManager.encoded {
+		return key
+	}
+	return prefix + cacheManager.name + ":" + key
+}
+
+func (cacheManager *Manager[T]) SetValue(key string, value T) error {
+	return cacheManager.SetWithExpiration(key, value, cacheManager.ttl)
+}
+
+func (cacheManager *Manager[T]) SetWithExpiration(key string, value T, expir time.Duration) error {
+	timeout, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var obj any = value
+	if cacheManager.encoded {
+		bytes, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		obj = bytes
+	}
+	return cacheManager.store.Set(timeout, cacheManager.key(key), obj, store.WithExpiration(expir))
+}
+
+func (cacheManager *Manager[T]) GetValue(key string) (value T, err error) {
+	timeout, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	const errorMessage = "value not found"
+	obj, err := cacheManager.store.Get(timeout, cacheManager.key(key))
+	if err != nil {
+		if strings.Contains(err.Error(), errorMessage) {
+			err = nil
+		}
+		return
+	}
+
+	if !cacheManager.encoded {
+		value, _ = obj.(T)
+		return
+	}
+
+	var bytes []byte
+	switch v := obj.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		err = fmt.Errorf("cache '%s': unexpected value type %T", cacheManager.name, obj)
+		return
+	}
+	err = json.Unmarshal(bytes, &value)
+	return
+}
+
+func (cacheManager *Manager[T]) Delete(key string) error {
+	timeout, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return cacheManager.store.Delete(timeout, cacheManager.key(key))
+}
@@ -0,0 +1,281 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"chatgpt-adapter/core/gin/model"
+	"github.com/eko/gocache/lib/v4/store"
+	"github.com/iocgo/sdk/env"
+)
+
+// 写入临时配置并加载
+func newEnv(t *testing.T, config string) *env.Environment {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_PATH", path)
+	environment, err := env.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return environment
+}
+
+// 仅实现 PING / GET / SET / DEL 的 RESP2 服务，不支持 HELLO 时客户端回退到 RESP2
+type fakeRedis struct {
+	mu      sync.Mutex
+	values  map[string]string
+	expires map[string]time.Time
+	addr    string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	server := &fakeRedis{values: make(map[string]string), expires: make(map[string]time.Time), addr: listener.Addr().String()}
+	go func() {
+		for {
+			conn, e := listener.Accept()
+			if e != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (server *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		if _, err = conn.Write([]byte(server.exec(args))); err != nil {
+			return
+		}
+	}
+}
+
+func (server *fakeRedis) exec(args []string) string {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "GET":
+		value, ok := server.values[args[1]]
+		if expire, o := server.expires[args[1]]; !ok || o && time.Now().After(expire) {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "SET":
+		server.values[args[1]] = args[2]
+		delete(server.expires, args[1])
+		if len(args) == 5 {
+			n, _ := strconv.Atoi(args[4])
+			unit := time.Second
+			if strings.EqualFold(args[3], "PX") {
+				unit = time.Millisecond
+			}
+			server.expires[args[1]] = time.Now().Add(time.Duration(n) * unit)
+		}
+		return "+OK\r\n"
+	case "DEL":
+		n := 0
+		for _, key := range args[1:] {
+			if _, ok := server.values[key]; ok {
+				delete(server.values, key)
+				n++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	default:
+		return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+	}
+}
+
+func (server *fakeRedis) keys() (slice []string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	for key := range server.values {
+		slice = append(slice, key)
+	}
+	return
+}
+
+func readCommand(reader *bufio.Reader) (args []string, err error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, errors.New("inline commands are not supported")
+	}
+
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	for i := 0; i < n; i++ {
+		if line, err = reader.ReadString('\n'); err != nil {
+			return
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		buffer := make([]byte, size+2)
+		if _, err = io.ReadFull(reader, buffer); err != nil {
+			return
+		}
+		args = append(args, string(buffer[:size]))
+	}
+	return
+}
+
+func TestDiskStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "cache.db")
+	s, err := NewDiskStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err = s.Set(ctx, "forever", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Set(ctx, "short", []byte("b"), store.WithExpiration(50*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Set(ctx, "long", []byte("c"), store.WithExpiration(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Set(ctx, "number", 1); err == nil {
+		t.Error("Set() accepted an unsupported value type")
+	}
+
+	// 重新打开后数据仍然有效
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = NewDiskStore(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	value, ttl, err := s.GetWithTTL(ctx, "long")
+	if err != nil || string(value.([]byte)) != "c" || ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Errorf("GetWithTTL(long) = %v, %s, %v", value, ttl, err)
+	}
+	if value, ttl, err = s.GetWithTTL(ctx, "forever"); err != nil || string(value.([]byte)) != "a" || ttl != 0 {
+		t.Errorf("GetWithTTL(forever) = %v, %s, %v", value, ttl, err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, err = s.Get(ctx, "short"); !errors.Is(err, store.NotFound{}) {
+		t.Errorf("Get(short) error = %v, want not found", err)
+	}
+
+	if err = s.Delete(ctx, "forever"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Get(ctx, "forever"); !errors.Is(err, store.NotFound{}) {
+		t.Errorf("Get(forever) error = %v, want not found after Delete", err)
+	}
+
+	if err = s.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Get(ctx, "long"); !errors.Is(err, store.NotFound{}) {
+		t.Errorf("Get(long) error = %v, want not found after Clear", err)
+	}
+}
+
+func TestManager(t *testing.T) {
+	redis := newFakeRedis(t)
+	tests := []struct {
+		name   string
+		config string
+		keys   []string
+	}{
+		{"memory", "cache:\n  type: memory\n", nil},
+		{"disk", fmt.Sprintf("cache:\n  type: disk\n  disk:\n    path: %s\n", filepath.Join(t.TempDir(), "cache.db")), nil},
+		{"redis", fmt.Sprintf("cache:\n  type: redis\n  redis:\n    addr: %s\n    prefix: \"test:\"\n", redis.addr), []string{"test:tool-tasks:k", "test:windsurf:k"}},
+	}
+
+	defer func(saved string) { prefix = saved }(prefix)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			environment := newEnv(t, tt.config)
+			newStore, err := storeBuilder(environment)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tasks := newManager[[]model.Keyv[string]](environment, "tool-tasks", newStore)
+			tokens := newManager[string](environment, "windsurf", newStore)
+			if tasks.ttl != 120*time.Second || tokens.ttl != time.Hour {
+				t.Errorf("ttl = %s, %s", tasks.ttl, tokens.ttl)
+			}
+
+			want := []model.Keyv[string]{{"task": "weather"}}
+			if err = tasks.SetValue("k", want); err != nil {
+				t.Fatal(err)
+			}
+			if err = tokens.SetValue("k", "token"); err != nil {
+				t.Fatal(err)
+			}
+
+			// 共享存储以名称区分，不同管理器的同名键互不影响
+			if got, e := tasks.GetValue("k"); e != nil || !reflect.DeepEqual(got, want) {
+				t.Errorf("tasks.GetValue() = %v, %v, want %v", got, e, want)
+			}
+			if got, e := tokens.GetValue("k"); e != nil || got != "token" {
+				t.Errorf("tokens.GetValue() = %q, %v", got, e)
+			}
+			if tt.keys != nil {
+				keys := redis.keys()
+				sort.Strings(keys)
+				if !reflect.DeepEqual(keys, tt.keys) {
+					t.Errorf("redis keys = %v, want %v", keys, tt.keys)
+				}
+			}
+
+			if err = tokens.SetWithExpiration("short", "x", 50*time.Millisecond); err != nil {
+				t.Fatal(err)
+			}
+			if err = tokens.Delete("k"); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(60 * time.Millisecond)
+			for _, key := range []string{"k", "short", "missing"} {
+				if got, e := tokens.GetValue(key); e != nil || got != "" {
+					t.Errorf("tokens.GetValue(%q) = %q, %v, want empty", key, got, e)
+				}
+			}
+		})
+	}
+
+	if _, err := storeBuilder(newEnv(t, "cache:\n  type: etcd\n")); err == nil {
+		t.Error("storeBuilder() accepted an unknown type")
+	}
+}
@@ -254,3 +254,191 @@ Generate "prompt" according to the required description:
 """{{content}}"""
 
 prompt=`
+
+const ToolTasksEn = `{{- range $index, $value := .pMessages}}
+{{- if eq $value.role "tool" }}
+<|tool|>
+TOOL_RESPONSE:
+  name: "{{ ToolId $value.name }}"
+  description: "{{ ToolDesc $value.name }}"
+
+output: {{ $value.content }}
+<|end|>
+{{- else if and (eq $value.role "assistant") (gt (Len $value.tool_calls) 0) }}
+<|assistant|>
+{{- range $toolCall := $value.tool_calls }}
+TOOL_CALL:
+  name: "{{ ToolId $toolCall.function.name }}"
+  arguments: "{{ $toolCall.function.arguments }}"
+{{- end }}
+<|end|>
+{{ else }}
+<|{{$value.role}}|>
+{{$value.content}}
+<|end|>
+{{end -}}
+{{end}}
+
+
+You are an intelligent assistant that specializes in breaking a request down into sub-tasks. Sometimes you can rely on the results of tools to answer the user more accurately.
+
+Break the user's request down into at most 3 sub-tasks. In the process, USER is the user's input, TOOL_RESPONSE is the result of a tool and ASSISTANT is your output; a task is a string describing the sub-task.
+Read the context above and avoid sub-tasks unrelated to the latest user request.
+
+Every output must start with 0 or 1, indicating whether the request needs to be broken down:
+
+Each task-item contains two keys: "toolId" (string) and "task" (string).
+0: no sub-tasks.
+1: [{"toolId": "xxx", "task": "today's weather in xxx"}, ...].
+
+For example:
+
+USER: Hello <|end|>
+ANSWER: 0: no sub-tasks <|end|>
+USER: What's the weather like in Hangzhou today? <|end|>
+ANSWER: 1: [{"toolId": "testToolId", "task": "today's weather in Hangzhou"}] <|end|>
+TOOL_RESPONSE: """
+Sunny......
+"""
+
+USER: Where should I go in Hangzhou with today's weather? <|end|>
+ANSWER: 1: [{"toolId": "testToolId", "task": "today's weather in Hangzhou"}, {"toolId": "testToolId2", "task": "places to visit in Hangzhou for this weather"}] <|end|>
+TOOL_RESPONSE: """
+Sunny. West Lake, Lingyin Temple, Qiandao Lake......
+"""
+ANSWER: 0: no sub-tasks <|end|>
+
+USER: Get the weather in Shenzhen and send it to the QQ group <|end|>
+ANSWER: 1: [{"toolId": "testToolId", "task": "the weather in Shenzhen"}, {"toolId": "testToolId2", "task": "send the weather in Shenzhen to the QQ group"}] <|end|>
+
+
+Now let's begin! These are the tools you can use this time:
+"""
+[
+    {{- range $index, $value := .tools}}
+    {{- if eq $value.type "function" }}
+    {
+        "toolId": "{{$value.function.id}}",
+        "description": "{{$value.function.description}}",
+        "parameters": {
+             "type": "object",
+             "properties": {
+{{- range $key, $v := $value.function.parameters.properties}}
+                 "{{$key}}": {
+                     "type": "{{$v.type}}",
+                     "description": "{{ Enc $v.description }}"
+                 }
+{{- end }}
+             }
+        },
+        "required": [{{Join $value.function.parameters.required ", " }}]
+    },
+    {{- end -}}
+    {{- end}}
+]
+"""
+
+Below is the actual conversation. Output the sub-task list directly:
+USER: {{.content}}
+ANSWER: `
+
+const ToolCallEn = `{{- range $index, $value := .pMessages}}
+{{- if eq $value.role "tool" }}
+<|tool|>
+TOOL_RESPONSE:
+  name: "{{ ToolId $value.name }}"
+  description: "{{ ToolDesc $value.name }}"
+
+output: {{ $value.content }}
+<|end|>
+{{- else if and (eq $value.role "assistant") (gt (Len $value.tool_calls) 0) }}
+<|assistant|>
+{{- range $toolCall := $value.tool_calls }}
+TOOL_CALL:
+  name: "{{ ToolId $toolCall.function.name }}"
+  arguments: "{{ $toolCall.function.arguments }}"
+{{- end }}
+<|end|>
+{{ else }}
+<|{{$value.role}}|>
+{{$value.content}}
+<|end|>
+{{end -}}
+{{end}}
+
+
+You are an intelligent assistant that specializes in choosing tools for the user. You are in an offline environment and must not output the results of tools yourself. Sometimes you can rely on the results of tools to answer the user more accurately.
+
+Tools are declared in JSON Schema format: toolId identifies the tool, description describes it, parameters lists its arguments with their types and descriptions, and required lists the mandatory arguments.
+toolId is how the user invokes a tool, so always include it when a tool needs to be called.
+
+Based on the tool descriptions, decide whether to answer the question or to use a tool. In the process, USER is the user's input, TOOL_RESPONSE is the result of a tool and ASSISTANT is your output.
+{{- if eq .toolDef "-1" }}
+Every output must start with 0 or 1, indicating whether a tool needs to be called:
+0: do not use a tool.
+1: use a tool and return the arguments of the call.
+{{- else }}
+This output must start with 1, indicating whether a tool needs to be called:
+0: do not use a tool.
+1: use a tool and return the arguments of the call.
+{{- end }}
+For example:
+
+USER: Hello <|end|>
+{{- if eq .toolDef "-1" }}
+ANSWER: 0: <|end|>
+{{- else }}
+ANSWER: 1: {"toolId":"{{.toolDef}}","arguments":{}} <|end|>
+{{- end }}
+
+USER: What's the weather like in Hangzhou today? <|end|>
+ANSWER: 1: {"toolId":"testToolId","arguments":{"city": "Hangzhou"}} <|end|>
+TOOL_RESPONSE: """
+Sunny......
+"""
+
+USER: Where should I go in Hangzhou with today's weather? <|end|>
+ANSWER: 1: {"toolId":"testToolId2","arguments":{"query": "Hangzhou weather places to visit"}} <|end|>
+TOOL_RESPONSE: """
+Sunny. West Lake, Lingyin Temple, Qiandao Lake......
+"""
+{{- if eq .toolDef "-1" }}
+ANSWER: 0: <|end|>
+{{- else }}
+ANSWER: 1: {"toolId":"{{.toolDef}}","arguments":{}} <|end|>
+{{- end }}
+
+
+Now let's begin! These are the tools you can use this time:
+"""
+[
+    {{- range $index, $value := .tools}}
+    {{- if eq $value.type "function" }}
+    {
+        "toolId": "{{$value.function.id}}",
+        "description": "{{$value.function.description}}",
+        "parameters": {
+             "type": "object",
+             "properties": {
+{{- range $key, $v := $value.function.parameters.properties}}
+                 "{{$key}}": {
+                     "type": "{{$v.type}}",
+                     "description": "{{ Enc $v.description }}"{{ if gt (Len $v.enum) 0 }},
+                     "enum": [{{ Join $v.enum ", " }}]{{end}}
+                 }
+{{- end }}
+             }
+        },
+        "required": [{{Join $value.function.parameters.required ", " }}]
+    },
+    {{- end -}}
+    {{- end}}
+]
+"""
+
+{{ if gt (len .excludeTaskContents) 0 }}
+Note: {{ .excludeTaskContents }}.
+{{- end }}
+Below is the actual conversation. Output the tool call directly:
+USER: {{.content}}
+ANSWER: `
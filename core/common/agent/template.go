@@ -0,0 +1,340 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/core/logger"
+	"github.com/iocgo/sdk/env"
+)
+
+const (
+	NameToolTasks = "ToolTasks"
+	NameToolCall  = "ToolCall"
+	NameSDWords   = "SDWords"
+	NameSD2Words  = "SD2Words"
+)
+
+// 内置模板，作为所有覆盖项的兜底
+var builtin = map[string]string{
+	NameToolTasks: ToolTasks,
+	NameToolCall:  ToolCall,
+	NameSDWords:   SDWords,
+	NameSD2Words:  SD2Words,
+}
+
+// 按语言区分的内置模板，key 为 <Name>.<lang>；未配置语言时使用上面的中文模板
+var builtinLang = map[string]string{
+	NameToolTasks + ".en": ToolTasksEn,
+	NameToolCall + ".en":  ToolCallEn,
+}
+
+// 外部模板配置：
+//
+//	agent:
+//	  lang: en          # 默认语言，内置 en 的工具模板，其余语言需自行提供
+//	  dir: templates    # 模板目录，文件名 <Name>.tpl 或 <Name>.<lang>.tpl，删除文件后热加载时移除
+//	  reload: 30s       # 热加载检查间隔，不配置则不开启
+//	  models:           # 按模型指定语言
+//	    - model: deepseek/*
+//	      lang: zh
+//	  templates:        # 单独指定的模板，可按模型或语言覆盖
+//	    - name: ToolCall
+//	      model: custom/*
+//	      lang: en
+//	      file: templates/custom-toolcall.tpl
+//	      content: ...
+type templateObj struct {
+	Name    string `mapstructure:"name"`
+	Model   string `mapstructure:"model"`
+	Lang    string `mapstructure:"lang"`
+	File    string `mapstructure:"file"`
+	Content string `mapstructure:"content"`
+
+	modTime time.Time
+}
+
+type langObj struct {
+	Model string `mapstructure:"model"`
+	Lang  string `mapstructure:"lang"`
+}
+
+var (
+	mu         sync.RWMutex
+	lang       string
+	dir        string
+	langs      []langObj
+	templates  []*templateObj
+	dirs       = make(map[string]*templateObj)
+	validators = make(map[string]func(template string) error)
+)
+
+// 注册模板校验器，启动及热加载时对模板进行试渲染
+func AddValidator(name string, validator func(template string) error) {
+	validators[name] = validator
+}
+
+func init() {
+	// 绘图提示词模板只做 {{content}} 的文本替换
+	for _, name := range []string{NameSDWords, NameSD2Words} {
+		AddValidator(name, func(template string) error {
+			if !strings.Contains(template, "{{content}}") {
+				return fmt.Errorf("missing placeholder {{content}}")
+			}
+			return nil
+		})
+	}
+
+	inited.AddInitialized(func(env *env.Environment) {
+		lang = env.GetString("agent.lang")
+		dir = env.GetString("agent.dir")
+		if err := env.UnmarshalKey("agent.models", &langs); err != nil {
+			logger.Fatal(err)
+		}
+		if err := env.UnmarshalKey("agent.templates", &templates); err != nil {
+			logger.Fatal(err)
+		}
+
+		for _, obj := range templates {
+			if _, ok := builtin[obj.Name]; !ok {
+				logger.Fatalf("unknown agent template: %s", obj.Name)
+			}
+			if err := obj.load(); err != nil {
+				logger.Fatal(err)
+			}
+		}
+		if err := loadDir(); err != nil {
+			logger.Fatal(err)
+		}
+
+		for name := range builtin {
+			for _, tpl := range variants(name) {
+				if err := validate(name, tpl); err != nil {
+					logger.Fatal(err)
+				}
+			}
+		}
+
+		if interval := env.GetDuration("agent.reload"); interval > 0 {
+			go reload(interval)
+		}
+	})
+}
+
+// 获取模板，优先级：指定模型 > 模型语言 > 默认语言 > 通用覆盖 > 内置语言 > 内置
+func Template(name, model string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	l := langWithModel(model)
+	for _, obj := range templates {
+		if obj.Name == name && obj.Model != "" && match(obj.Model, model) && (obj.Lang == "" || obj.Lang == l) {
+			return obj.Content
+		}
+	}
+
+	if l != "" {
+		for _, obj := range templates {
+			if obj.Name == name && obj.Model == "" && obj.Lang == l {
+				return obj.Content
+			}
+		}
+		if obj, ok := dirs[name+"."+l]; ok {
+			return obj.Content
+		}
+	}
+
+	if obj, ok := dirs[name]; ok {
+		return obj.Content
+	}
+	for _, obj := range templates {
+		if obj.Name == name && obj.Model == "" && obj.Lang == "" {
+			return obj.Content
+		}
+	}
+	if tpl, ok := builtinLang[name+"."+l]; ok {
+		return tpl
+	}
+	return builtin[name]
+}
+
+func langWithModel(model string) string {
+	for _, obj := range langs {
+		if match(obj.Model, model) {
+			return obj.Lang
+		}
+	}
+	return lang
+}
+
+func match(pattern, model string) bool {
+	if pattern == model {
+		return true
+	}
+	matched, _ := path.Match(pattern, model)
+	return matched
+}
+
+func (obj *templateObj) load() error {
+	if obj.File == "" {
+		return nil
+	}
+
+	info, err := os.Stat(obj.File)
+	if err != nil {
+		return fmt.Errorf("agent template %s: %v", obj.Name, err)
+	}
+	if !info.ModTime().After(obj.modTime) {
+		return nil
+	}
+
+	bytes, err := os.ReadFile(obj.File)
+	if err != nil {
+		return fmt.Errorf("agent template %s: %v", obj.Name, err)
+	}
+
+	obj.Content = string(bytes)
+	obj.modTime = info.ModTime()
+	return nil
+}
+
+// 读取模板目录，文件名去掉 .tpl 后缀即为 <Name> 或 <Name>.<lang>
+func loadDir() error {
+	if dir == "" {
+		return nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.tpl"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		key := strings.TrimSuffix(filepath.Base(file), ".tpl")
+		name, _, _ := strings.Cut(key, ".")
+		if _, ok := builtin[name]; !ok {
+			logger.Warnf("unknown agent template file: %s", file)
+			continue
+		}
+
+		obj, ok := dirs[key]
+		if !ok {
+			obj = &templateObj{Name: name, File: file}
+		}
+		if err = obj.load(); err != nil {
+			return err
+		}
+		dirs[key] = obj
+	}
+	return nil
+}
+
+// 所有生效的模板变体，用于校验
+func variants(name string) (slice []string) {
+	slice = append(slice, builtin[name])
+	for key, tpl := range builtinLang {
+		if strings.HasPrefix(key, name+".") {
+			slice = append(slice, tpl)
+		}
+	}
+	for _, obj := range templates {
+		if obj.Name == name {
+			slice = append(slice, obj.Content)
+		}
+	}
+	for _, obj := range dirs {
+		if obj.Name == name {
+			slice = append(slice, obj.Content)
+		}
+	}
+	return
+}
+
+func validate(name, template string) error {
+	if strings.TrimSpace(template) == "" {
+		return fmt.Errorf("agent template %s is empty", name)
+	}
+
+	validator, ok := validators[name]
+	if !ok {
+		return nil
+	}
+
+	if err := validator(template); err != nil {
+		return fmt.Errorf("agent template %s is invalid: %v", name, err)
+	}
+	return nil
+}
+
+// 定时检查文件修改时间，校验通过后替换；模板目录每次重新扫描，已删除的文件不再生效
+func reload(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		mu.Lock()
+		for _, obj := range templates {
+			reloadObj(obj)
+		}
+
+		if dir != "" {
+			if files, err := filepath.Glob(filepath.Join(dir, "*.tpl")); err != nil {
+				logger.Error(err)
+			} else {
+				dirs = reloadDir(files)
+			}
+		}
+		mu.Unlock()
+	}
+}
+
+func reloadDir(files []string) map[string]*templateObj {
+	next := make(map[string]*templateObj)
+	for _, file := range files {
+		key := strings.TrimSuffix(filepath.Base(file), ".tpl")
+		name, _, _ := strings.Cut(key, ".")
+		if _, ok := builtin[name]; !ok {
+			continue
+		}
+
+		obj, ok := dirs[key]
+		if !ok {
+			obj = &templateObj{Name: name, File: file}
+		}
+		// 已加载的模板校验失败时保留旧内容，新文件校验失败时忽略
+		if reloadObj(obj) || ok {
+			next[key] = obj
+		}
+	}
+
+	for key, obj := range dirs {
+		if _, ok := next[key]; !ok {
+			logger.Infof("agent template removed: %s", obj.File)
+		}
+	}
+	return next
+}
+
+func reloadObj(obj *templateObj) bool {
+	content, modTime := obj.Content, obj.modTime
+	if err := obj.load(); err != nil {
+		logger.Error(err)
+		return false
+	}
+	if obj.modTime.Equal(modTime) {
+		return true
+	}
+
+	if err := validate(obj.Name, obj.Content); err != nil {
+		logger.Error(err)
+		obj.Content = content
+		return false
+	}
+	logger.Infof("agent template reloaded: %s", obj.File)
+	return true
+}
@@ -0,0 +1,312 @@
+package conversation
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/logger"
+	"github.com/google/uuid"
+	"github.com/iocgo/sdk/env"
+)
+
+// 服务端会话配置：
+//
+//	conversation:
+//	  enabled: true
+//	  dir: data/conversations   # 可选，持久化目录，每个会话一个 <id>.json
+//	  ttl: 24h                  # 闲置过期时间，默认 24h
+//	  max-messages: 200         # 单个会话保留的最大消息数，超出丢弃最早的非 system 消息
+//
+// 会话归属于创建它的客户端 key（哈希），其他客户端不可读取、续写或删除
+type Conversation struct {
+	Id       string                    `json:"id"`
+	Owner    string                    `json:"owner"`
+	Model    string                    `json:"model"`
+	Title    string                    `json:"title"`
+	Created  int64                     `json:"created"`
+	Updated  int64                     `json:"updated"`
+	Messages []model.Keyv[interface{}] `json:"messages"`
+}
+
+var (
+	mu      sync.RWMutex
+	enabled bool
+	dir     string
+	ttl     = 24 * time.Hour
+	maxL    = 200
+	store   = make(map[string]*Conversation)
+
+	idRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+)
+
+func init() {
+	inited.AddInitialized(func(env *env.Environment) {
+		enabled = env.GetBool("conversation.enabled")
+		if !enabled {
+			return
+		}
+
+		dir = env.GetString("conversation.dir")
+		if value := env.GetDuration("conversation.ttl"); value > 0 {
+			ttl = value
+		}
+		if value := env.GetInt("conversation.max-messages"); value > 0 {
+			maxL = value
+		}
+
+		load()
+		go cleanup()
+	})
+}
+
+func Enabled() bool { return enabled }
+
+// 校验会话 id，"new" 表示由服务端生成
+func NewId(id string) (string, bool) {
+	if id == "new" {
+		return uuid.NewString(), true
+	}
+	return id, idRegexp.MatchString(id)
+}
+
+// owner 为空时不校验归属，仅管理员使用
+func Get(id, owner string) (*Conversation, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	conversation, ok := store[id]
+	if !ok || !conversation.ownedBy(owner) {
+		return nil, false
+	}
+	return conversation.clone(), true
+}
+
+// 按更新时间倒序，不包含消息内容
+func List(owner string) (slice []Conversation) {
+	mu.RLock()
+	defer mu.RUnlock()
+	slice = make([]Conversation, 0, len(store))
+	for _, conversation := range store {
+		if !conversation.ownedBy(owner) {
+			continue
+		}
+		obj := *conversation
+		obj.Messages = nil
+		slice = append(slice, obj)
+	}
+	sort.Slice(slice, func(i, j int) bool { return slice[i].Updated > slice[j].Updated })
+	return
+}
+
+func Delete(id, owner string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	if conversation, ok := store[id]; !ok || !conversation.ownedBy(owner) {
+		return false
+	}
+	delete(store, id)
+	remove(id)
+	return true
+}
+
+// 会话是否可由 owner 使用：不存在或归属一致
+func Usable(id, owner string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	conversation, ok := store[id]
+	return !ok || conversation.ownedBy(owner)
+}
+
+// 历史消息拼接本次新消息；新消息带 system 时替换历史中的 system
+func Merge(id, owner string, messages []model.Keyv[interface{}]) []model.Keyv[interface{}] {
+	conversation, ok := Get(id, owner)
+	if !ok || len(conversation.Messages) == 0 {
+		return messages
+	}
+
+	history := conversation.Messages
+	if len(messages) > 0 && messages[0].Is("role", "system") && history[0].Is("role", "system") {
+		history = history[1:]
+	}
+
+	result := make([]model.Keyv[interface{}], 0, len(history)+len(messages))
+	for _, message := range messages {
+		if message.Is("role", "system") {
+			result = append(result, message)
+		}
+	}
+	result = append(result, history...)
+	for _, message := range messages {
+		if !message.Is("role", "system") {
+			result = append(result, message)
+		}
+	}
+	return result
+}
+
+// 追加本轮的新消息与助手回复，新建的会话归属于 owner
+func Append(id, owner, mod string, messages []model.Keyv[interface{}], reply model.Keyv[interface{}]) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := time.Now().Unix()
+	conversation, ok := store[id]
+	if !ok {
+		conversation = &Conversation{Id: id, Owner: owner, Created: now}
+		store[id] = conversation
+	}
+	if !conversation.ownedBy(owner) {
+		logger.Warnf("conversation %s is not owned by the client, ignored", id)
+		return
+	}
+
+	conversation.Model = mod
+	conversation.Updated = now
+	for _, message := range messages {
+		if message.Is("role", "system") && len(conversation.Messages) > 0 && conversation.Messages[0].Is("role", "system") {
+			conversation.Messages[0] = message
+			continue
+		}
+		if message.Is("role", "system") {
+			conversation.Messages = append([]model.Keyv[interface{}]{message}, conversation.Messages...)
+			continue
+		}
+		conversation.Messages = append(conversation.Messages, message)
+	}
+	if reply != nil {
+		conversation.Messages = append(conversation.Messages, reply)
+	}
+
+	conversation.truncate()
+	if conversation.Title == "" {
+		conversation.Title = title(conversation.Messages)
+	}
+	save(conversation)
+}
+
+func (conversation *Conversation) ownedBy(owner string) bool {
+	return owner == "" || conversation.Owner == owner
+}
+
+func (conversation *Conversation) clone() *Conversation {
+	obj := *conversation
+	obj.Messages = append([]model.Keyv[interface{}](nil), conversation.Messages...)
+	return &obj
+}
+
+// 超出上限时丢弃最早的非 system 消息
+func (conversation *Conversation) truncate() {
+	messages := conversation.Messages
+	if len(messages) <= maxL {
+		return
+	}
+
+	pos := 0
+	if messages[0].Is("role", "system") {
+		pos = 1
+	}
+	overflow := len(messages) - maxL
+	conversation.Messages = append(messages[:pos:pos], messages[pos+overflow:]...)
+}
+
+func title(messages []model.Keyv[interface{}]) string {
+	for _, message := range messages {
+		if message.Is("role", "user") && !message.IsSlice("content") {
+			runes := []rune(message.GetString("content"))
+			if len(runes) > 50 {
+				runes = append(runes[:50], []rune("...")...)
+			}
+			return string(runes)
+		}
+	}
+	return ""
+}
+
+// 定时清理闲置过期的会话
+func cleanup() {
+	for {
+		time.Sleep(10 * time.Minute)
+		expired := time.Now().Add(-ttl).Unix()
+		mu.Lock()
+		for id, conversation := range store {
+			if conversation.Updated < expired {
+				delete(store, id)
+				remove(id)
+				logger.Infof("conversation expired: %s", id)
+			}
+		}
+		mu.Unlock()
+	}
+}
+
+func load() {
+	if dir == "" {
+		return
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	expired := time.Now().Add(-ttl).Unix()
+	for _, file := range files {
+		data, e := os.ReadFile(file)
+		if e != nil {
+			logger.Warnf("load conversation %s failed: %v", file, e)
+			continue
+		}
+
+		var conversation Conversation
+		if e = json.Unmarshal(data, &conversation); e != nil || conversation.Id == "" {
+			logger.Warnf("load conversation %s failed: %v", file, e)
+			continue
+		}
+		if conversation.Updated < expired {
+			_ = os.Remove(file)
+			continue
+		}
+		store[conversation.Id] = &conversation
+	}
+	logger.Infof("loaded %d conversations from %s", len(store), dir)
+}
+
+func save(conversation *Conversation) {
+	if dir == "" {
+		return
+	}
+
+	data, err := json.Marshal(conversation)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	file := filepath.Join(dir, conversation.Id+".json")
+	if err = os.WriteFile(file+".tmp", data, 0600); err == nil {
+		err = os.Rename(file+".tmp", file)
+	}
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+func remove(id string) {
+	if dir == "" {
+		return
+	}
+	if err := os.Remove(filepath.Join(dir, id+".json")); err != nil && !os.IsNotExist(err) {
+		logger.Error(err)
+	}
+}
@@ -0,0 +1,169 @@
+package conversation
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"chatgpt-adapter/core/gin/model"
+)
+
+// 使用空的内存会话，测试结束后还原配置
+func reset(t *testing.T, directory string, max int) {
+	savedDir, savedMax, savedStore := dir, maxL, store
+	dir, maxL, store = directory, max, make(map[string]*Conversation)
+	t.Cleanup(func() { dir, maxL, store = savedDir, savedMax, savedStore })
+}
+
+func message(role, content string) model.Keyv[interface{}] {
+	return model.Keyv[interface{}]{"role": role, "content": content}
+}
+
+func contents(messages []model.Keyv[interface{}]) (slice []string) {
+	for _, message := range messages {
+		slice = append(slice, message.GetString("role")+":"+message.GetString("content"))
+	}
+	return
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestNewId(t *testing.T) {
+	tests := []struct {
+		id string
+		ok bool
+	}{
+		{"new", true},
+		{"chat_01-a", true},
+		{"", false},
+		{"../etc/passwd", false},
+		{"a b", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			id, ok := NewId(tt.id)
+			if ok != tt.ok {
+				t.Fatalf("NewId(%q) ok = %v, want %v", tt.id, ok, tt.ok)
+			}
+			if tt.id == "new" && (id == "new" || !idRegexp.MatchString(id)) {
+				t.Errorf("NewId(%q) = %q, want a generated id", tt.id, id)
+			}
+		})
+	}
+}
+
+func TestOwner(t *testing.T) {
+	reset(t, "", 200)
+	Append("c1", "alice", "gpt", []model.Keyv[interface{}]{message("user", "hello")}, message("assistant", "hi"))
+
+	tests := []struct {
+		owner  string
+		usable bool
+	}{
+		{"alice", true},
+		{"", true},
+		{"bob", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.owner, func(t *testing.T) {
+			if _, ok := Get("c1", tt.owner); ok != tt.usable {
+				t.Errorf("Get() ok = %v, want %v", ok, tt.usable)
+			}
+			if ok := Usable("c1", tt.owner); ok != tt.usable {
+				t.Errorf("Usable() = %v, want %v", ok, tt.usable)
+			}
+			if n := len(List(tt.owner)); (n == 1) != tt.usable {
+				t.Errorf("List() = %d conversations", n)
+			}
+		})
+	}
+
+	// 其他客户端不能续写
+	Append("c1", "bob", "gpt", []model.Keyv[interface{}]{message("user", "steal")}, nil)
+	if conversation, _ := Get("c1", "alice"); len(conversation.Messages) != 2 || conversation.Title != "hello" {
+		t.Errorf("conversation = %+v", conversation)
+	}
+	if Delete("c1", "bob") || !Delete("c1", "alice") {
+		t.Error("only the owner can delete the conversation")
+	}
+	// 删除后 id 可被其他客户端重新使用
+	if !Usable("c1", "bob") {
+		t.Error("deleted conversation is still owned")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	reset(t, "", 200)
+	Append("c1", "alice", "gpt", []model.Keyv[interface{}]{message("system", "old"), message("user", "q1")}, message("assistant", "a1"))
+
+	tests := []struct {
+		name     string
+		owner    string
+		messages []model.Keyv[interface{}]
+		want     []string
+	}{
+		{"history", "alice", []model.Keyv[interface{}]{message("user", "q2")}, []string{"system:old", "user:q1", "assistant:a1", "user:q2"}},
+		{"replace system", "alice", []model.Keyv[interface{}]{message("system", "new"), message("user", "q2")}, []string{"system:new", "user:q1", "assistant:a1", "user:q2"}},
+		{"other owner", "bob", []model.Keyv[interface{}]{message("user", "q2")}, []string{"user:q2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := contents(Merge("c1", tt.owner, tt.messages)); !equal(got, tt.want) {
+				t.Errorf("Merge() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendTruncate(t *testing.T) {
+	reset(t, "", 3)
+	Append("c1", "", "gpt", []model.Keyv[interface{}]{message("system", "s"), message("user", "q1")}, message("assistant", "a1"))
+	Append("c1", "", "gpt", []model.Keyv[interface{}]{message("system", "s2"), message("user", "q2")}, message("assistant", "a2"))
+
+	conversation, _ := Get("c1", "")
+	if got, want := contents(conversation.Messages), []string{"system:s2", "user:q2", "assistant:a2"}; !equal(got, want) {
+		t.Errorf("messages = %q, want %q", got, want)
+	}
+}
+
+func TestPersist(t *testing.T) {
+	directory := t.TempDir()
+	reset(t, directory, 200)
+	Append("c1", "alice", "gpt", []model.Keyv[interface{}]{message("user", "hello")}, message("assistant", "hi"))
+
+	expired := Conversation{Id: "old", Updated: time.Now().Add(-2 * ttl).Unix()}
+	data, _ := json.Marshal(expired)
+	if err := os.WriteFile(filepath.Join(directory, "old.json"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	store = make(map[string]*Conversation)
+	load()
+	conversation, ok := Get("c1", "alice")
+	if !ok || len(conversation.Messages) != 2 || conversation.Model != "gpt" {
+		t.Fatalf("loaded conversation = %+v", conversation)
+	}
+	if _, err := os.Stat(filepath.Join(directory, "old.json")); !os.IsNotExist(err) {
+		t.Error("expired conversation file is kept")
+	}
+
+	Delete("c1", "alice")
+	if _, err := os.Stat(filepath.Join(directory, "c1.json")); !os.IsNotExist(err) {
+		t.Error("deleted conversation file is kept")
+	}
+}
@@ -0,0 +1,240 @@
+package document
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/core/common/vision"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/logger"
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/iocgo/sdk/env"
+	"github.com/patrickmn/go-cache"
+)
+
+// 文档附件配置，将 PDF / DOCX / 纯文本附件提取为文本后拼入提示词：
+//
+//	document:
+//	  enabled: true             # 默认开启；原生处理文件的适配器（如 deepseek）默认不提取
+//	  max-size: 10485760        # 单个文件的最大字节数
+//	  max-chars: 50000          # 单个文档保留的最大字符数，超出截断
+//	  max-total: 200000         # 单次请求所有文档的字符总数上限
+//	  models:                   # 按模型覆盖开关，支持通配符，优先于适配器的默认行为
+//	    - model: "deepseek/*"
+//	      enabled: true         # 不使用上传接口，在本地提取为文本
+const (
+	MimePDF  = "application/pdf"
+	MimeDOCX = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+)
+
+type modelObj struct {
+	Model   string `mapstructure:"model"`
+	Enabled bool   `mapstructure:"enabled"`
+}
+
+var (
+	enabled  = true
+	maxSize  = 10 * 1024 * 1024
+	maxChars = 50000
+	maxTotal = 200000
+	models   []modelObj
+
+	// 按内容哈希缓存提取结果，多轮对话重复发送时不再解析
+	extracted = cache.New(30*time.Minute, 10*time.Minute)
+
+	ErrUnsupported = errors.New("unsupported document type")
+)
+
+func init() {
+	inited.AddInitialized(func(env *env.Environment) {
+		if env.IsSet("document.enabled") {
+			enabled = env.GetBool("document.enabled")
+		}
+		if value := env.GetInt("document.max-size"); value > 0 {
+			maxSize = value
+		}
+		if value := env.GetInt("document.max-chars"); value > 0 {
+			maxChars = value
+		}
+		if value := env.GetInt("document.max-total"); value > 0 {
+			maxTotal = value
+		}
+		if err := env.UnmarshalKey("document.models", &models); err != nil {
+			logger.Fatal(err)
+		}
+	})
+}
+
+// 按配置顺序匹配模型；未匹配时原生处理文件的适配器不提取，其余使用全局开关
+func Enabled(mod string, native bool) bool {
+	for _, obj := range models {
+		if ok, _ := path.Match(obj.Model, mod); ok || obj.Model == mod {
+			return obj.Enabled
+		}
+	}
+	return enabled && !native
+}
+
+// 提取文档内容，返回文本与识别出的类型
+func Extract(name string, data []byte) (text, mime string, err error) {
+	if len(data) > maxSize {
+		err = fmt.Errorf("document '%s' size %d exceeds %d", name, len(data), maxSize)
+		return
+	}
+
+	mtype := mimetype.Detect(data)
+	mime = mtype.String()
+	switch {
+	case mtype.Is(MimePDF):
+		mime = MimePDF
+		text, err = extractPDF(data)
+	case mtype.Is(MimeDOCX) || (mtype.Is("application/zip") && strings.HasSuffix(strings.ToLower(name), ".docx")):
+		mime = MimeDOCX
+		text, err = extractDOCX(data)
+	case isText(mtype):
+		text = strings.TrimPrefix(string(data), "\ufeff")
+		if !utf8.ValidString(text) {
+			err = fmt.Errorf("document '%s' is not valid utf-8 text", name)
+		}
+	default:
+		err = fmt.Errorf("%w: '%s' (%s)", ErrUnsupported, name, mime)
+	}
+	if err != nil {
+		return
+	}
+
+	text = strings.TrimSpace(text)
+	return
+}
+
+// json、csv、xml 等文本格式的上级类型均为 text/plain
+func isText(mtype *mimetype.MIME) bool {
+	for m := mtype; m != nil; m = m.Parent() {
+		if m.Is("text/plain") {
+			return true
+		}
+	}
+	return false
+}
+
+// 截断到 limit 个字符
+func truncate(text string, limit int) (string, bool) {
+	if utf8.RuneCountInString(text) <= limit {
+		return text, false
+	}
+	if limit < 0 {
+		limit = 0
+	}
+	runes := []rune(text)
+	return string(runes[:limit]), true
+}
+
+// 文档附件：file 类型的内容，以及 image_url 中非图片的 data url
+func documents(message model.Keyv[interface{}]) bool {
+	if !message.IsSlice("content") {
+		return false
+	}
+	for _, item := range message.GetSlice("content") {
+		if part, ok := item.(map[string]interface{}); ok && isDocument(part) {
+			return true
+		}
+	}
+	return false
+}
+
+func isDocument(part map[string]interface{}) bool {
+	switch part["type"] {
+	case "file":
+		return true
+	case "image_url":
+		url := model.Keyv[interface{}](part).GetKeyv("image_url").GetString("url")
+		return strings.HasPrefix(url, "data:") && !strings.HasPrefix(url, "data:image/")
+	}
+	return false
+}
+
+// 将消息中的文档附件替换为分隔好的文本块，返回处理的文档数
+func Convert(messages []model.Keyv[interface{}]) (result []model.Keyv[interface{}], count int, err error) {
+	total := 0
+	result = make([]model.Keyv[interface{}], len(messages))
+	for index, message := range messages {
+		if !documents(message) {
+			result[index] = message
+			continue
+		}
+
+		var parts []interface{}
+		for _, item := range message.GetSlice("content") {
+			part, ok := item.(map[string]interface{})
+			if !ok || !isDocument(part) {
+				parts = append(parts, item)
+				continue
+			}
+
+			count++
+			name, url := source(part)
+			if name == "" {
+				name = fmt.Sprintf("document-%d", count)
+			}
+
+			file, e := vision.LoadFile(url)
+			if e != nil {
+				err = fmt.Errorf("load document '%s' failed: %v", name, e)
+				return
+			}
+
+			var text, mime string
+			if value, ok := extracted.Get(file.Hash); ok {
+				pair := value.([2]string)
+				text, mime = pair[0], pair[1]
+			} else {
+				if text, mime, err = Extract(name, file.Data); err != nil {
+					return
+				}
+				extracted.SetDefault(file.Hash, [2]string{text, mime})
+			}
+
+			text, cut := truncate(text, min(maxChars, maxTotal-total))
+			chars := utf8.RuneCountInString(text)
+			total += chars
+			if cut {
+				text += "\n[truncated]"
+				logger.Warnf("document '%s' truncated to %d chars", name, chars)
+			}
+
+			parts = append(parts, map[string]interface{}{
+				"type": "text",
+				"text": fmt.Sprintf("<document name=\"%s\" type=\"%s\">\n%s\n</document>", name, mime, text),
+			})
+		}
+
+		obj := make(model.Keyv[interface{}], len(message))
+		for k, v := range message {
+			obj[k] = v
+		}
+		obj["content"] = parts
+		result[index] = obj
+	}
+	return
+}
+
+func source(part map[string]interface{}) (name, url string) {
+	kv := model.Keyv[interface{}](part)
+	if part["type"] == "image_url" {
+		url = kv.GetKeyv("image_url").GetString("url")
+		return
+	}
+
+	file := kv.GetKeyv("file")
+	name = strings.ReplaceAll(file.GetString("filename"), "\"", "")
+	url = file.GetString("file_data")
+	if url == "" {
+		url = file.GetString("url")
+	}
+	return
+}
@@ -0,0 +1,194 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"chatgpt-adapter/core/gin/model"
+)
+
+// 只包含 word/document.xml 的最小 docx
+func docxOf(t *testing.T, body string) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	w := zip.NewWriter(&buffer)
+	fw, err := w.Create("word/document.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = fw.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` + body + `</w:body></w:document>`))
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func zipOf(t *testing.T, name string) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	w := zip.NewWriter(&buffer)
+	if _, err := w.Create(name); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// 单页、使用内置 Helvetica 字体的最小 pdf
+func pdfOf(text string) []byte {
+	stream := fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text)
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream),
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buffer.Len()
+		fmt.Fprintf(&buffer, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buffer.Len()
+	fmt.Fprintf(&buffer, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buffer, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buffer, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buffer.Bytes()
+}
+
+func TestEnabled(t *testing.T) {
+	defer func(saved []modelObj) { models = saved }(models)
+	models = []modelObj{{Model: "deepseek/*", Enabled: true}, {Model: "gpt-4o", Enabled: false}}
+
+	tests := []struct {
+		model  string
+		native bool
+		want   bool
+	}{
+		{"deepseek/chat", true, true},
+		{"gpt-4o", false, false},
+		{"claude", false, true},
+		{"bing", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			if got := Enabled(tt.model, tt.native); got != tt.want {
+				t.Errorf("Enabled(%q, %v) = %v, want %v", tt.model, tt.native, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		text string
+		mime string
+		err  bool
+	}{
+		{"a.txt", []byte("\ufeff  hello\nworld \n"), "hello\nworld", "text/plain; charset=utf-8", false},
+		{"a.json", []byte(`{"a": 1}`), `{"a": 1}`, "application/json", false},
+		{"a.docx", docxOf(t, `<w:p><w:pPr><w:tabs><w:tab w:val="left"/></w:tabs></w:pPr><w:r><w:t>Hello</w:t><w:tab/><w:t>docx</w:t></w:r></w:p><w:p><w:r><w:t>line</w:t><w:br/><w:t>two</w:t></w:r></w:p>`), "Hello\tdocx\nline\ntwo", MimeDOCX, false},
+		{"a.pdf", pdfOf("Hello PDF"), "Hello PDF", MimePDF, false},
+		{"a.zip", zipOf(t, "a.txt"), "", "", true},
+		{"broken.docx", zipOf(t, "a.txt"), "", "", true},
+		{"broken.pdf", []byte("%PDF-1.4\nbroken"), "", "", true},
+		{"a.png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, mime, err := Extract(tt.name, tt.data)
+			if (err != nil) != tt.err {
+				t.Fatalf("Extract() error = %v, want error %v", err, tt.err)
+			}
+			if tt.err {
+				return
+			}
+			if text != tt.text || mime != tt.mime {
+				t.Errorf("Extract() = %q, %q, want %q, %q", text, mime, tt.text, tt.mime)
+			}
+		})
+	}
+
+	if _, _, err := Extract("a.png", []byte("\x89PNG\r\n\x1a\n")); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Extract() error = %v, want ErrUnsupported", err)
+	}
+
+	defer func(saved int) { maxSize = saved }(maxSize)
+	maxSize = 4
+	if _, _, err := Extract("a.txt", []byte("hello")); err == nil {
+		t.Error("Extract() accepted a document over max-size")
+	}
+}
+
+func TestConvert(t *testing.T) {
+	defer func(chars, total int) { maxChars, maxTotal = chars, total }(maxChars, maxTotal)
+	maxChars, maxTotal = 8, 12
+
+	dataURL := func(mime, text string) string {
+		return "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString([]byte(text))
+	}
+	image := map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "https://example.com/a.png"}}
+	messages := []model.Keyv[interface{}]{
+		{"role": "system", "content": "plain"},
+		{"role": "user", "content": []interface{}{
+			map[string]interface{}{"type": "text", "text": "read these"},
+			map[string]interface{}{"type": "file", "file": map[string]interface{}{"filename": `"a".txt`, "file_data": dataURL("text/plain", "short")}},
+			map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": dataURL("text/csv", "a,b\n1,2\n3,4")}},
+			image,
+		}},
+	}
+
+	result, count, err := Convert(messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 || len(result) != 2 || result[0]["content"] != "plain" {
+		t.Fatalf("Convert() = %v, %d", result, count)
+	}
+	if !messages[1].IsSlice("content") || len(messages[1].GetSlice("content")) != 4 {
+		t.Error("Convert() modified the original messages")
+	}
+
+	parts := result[1].GetSlice("content")
+	var texts []string
+	for _, part := range parts[:3] {
+		texts = append(texts, part.(map[string]interface{})["text"].(string))
+	}
+	want := []string{
+		"read these",
+		"<document name=\"a.txt\" type=\"text/plain; charset=utf-8\">\nshort\n</document>",
+		// 单个文档截断到 max-chars，同时受剩余总量限制
+		"<document name=\"document-2\" type=\"text/csv\">\na,b\n1,2\n[truncated]\n</document>",
+	}
+	for i := range want {
+		if texts[i] != want[i] {
+			t.Errorf("part %d = %q, want %q", i, texts[i], want[i])
+		}
+	}
+	if fmt.Sprint(parts[3]) != fmt.Sprint(image) {
+		t.Errorf("image part = %v, want it unchanged", parts[3])
+	}
+
+	unsupported := []model.Keyv[interface{}]{{"role": "user", "content": []interface{}{
+		map[string]interface{}{"type": "file", "file": map[string]interface{}{"filename": "a.bin", "file_data": dataURL("application/octet-stream", "\x00\x01\x02")}},
+	}}}
+	if _, _, err = Convert(unsupported); err == nil || !strings.Contains(err.Error(), "a.bin") {
+		t.Errorf("Convert() error = %v, want an unsupported document error", err)
+	}
+}
@@ -0,0 +1,141 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// 逐页提取 PDF 文本，超出字符上限后不再解析后续页面
+func extractPDF(data []byte) (text string, err error) {
+	// 解析损坏的文件时可能 panic
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("parse pdf failed: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return
+	}
+
+	var (
+		builder strings.Builder
+		fonts   = make(map[string]*pdf.Font)
+	)
+	for i := 1; i <= reader.NumPage(); i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+
+		for _, name := range page.Fonts() {
+			if _, ok := fonts[name]; !ok {
+				font := page.Font(name)
+				fonts[name] = &font
+			}
+		}
+
+		content, e := page.GetPlainText(fonts)
+		if e != nil {
+			err = e
+			return
+		}
+
+		builder.WriteString(strings.TrimSpace(content))
+		builder.WriteString("\n\n")
+		if builder.Len() > maxChars*4 {
+			break
+		}
+	}
+
+	text = builder.String()
+	if strings.TrimSpace(text) == "" {
+		err = fmt.Errorf("no text found in pdf, scanned documents are not supported")
+	}
+	return
+}
+
+// 读取 word/document.xml 中的段落文本
+func extractDOCX(data []byte) (text string, err error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return
+	}
+
+	var file *zip.File
+	for _, f := range reader.File {
+		if f.Name == "word/document.xml" {
+			file = f
+			break
+		}
+	}
+	if file == nil {
+		err = fmt.Errorf("invalid docx: word/document.xml not found")
+		return
+	}
+
+	rc, err := file.Open()
+	if err != nil {
+		return
+	}
+	defer rc.Close()
+
+	var (
+		builder strings.Builder
+		decoder = xml.NewDecoder(io.LimitReader(rc, int64(maxSize)*4))
+		inRun   bool
+		inText  bool
+	)
+	for {
+		token, e := decoder.Token()
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			err = e
+			return
+		}
+
+		switch elem := token.(type) {
+		case xml.StartElement:
+			// 段落属性中的 tabs 为制表位定义，只处理 run 内的元素
+			switch elem.Name.Local {
+			case "r":
+				inRun = true
+			case "t":
+				inText = true
+			case "tab":
+				if inRun {
+					builder.WriteString("\t")
+				}
+			case "br", "cr":
+				if inRun {
+					builder.WriteString("\n")
+				}
+			}
+		case xml.EndElement:
+			switch elem.Name.Local {
+			case "r":
+				inRun = false
+			case "t":
+				inText = false
+			case "p":
+				builder.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText {
+				builder.Write(elem)
+			}
+		}
+	}
+
+	text = builder.String()
+	return
+}
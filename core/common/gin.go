@@ -35,6 +35,14 @@ func GetGinCompletionUsage(ctx *gin.Context) map[string]interface{} {
 	return nil
 }
 
+func GetGinFinishReason(ctx *gin.Context) string {
+	reason := ctx.GetString(vars.GinFinishReason)
+	if reason == "" {
+		return "stop"
+	}
+	return reason
+}
+
 func GetGinToolValue(ctx *gin.Context) model.Keyv[interface{}] {
 	tool, ok := GetGinValue[model.Keyv[interface{}]](ctx, vars.GinTool)
 	if !ok {
@@ -231,6 +231,11 @@ func DownloadFile(session *emit.Session, proxies, url, suffix string, header map
 }
 
 func DownloadBuffer(session *emit.Session, proxies, url string, header map[string]string) (buffer []byte, err error) {
+	return DownloadBufferN(session, proxies, url, header, -1)
+}
+
+// 下载并限制最大字节数，limit < 0 时不限制；超出时不再继续读取
+func DownloadBufferN(session *emit.Session, proxies, url string, header map[string]string, limit int64) (buffer []byte, err error) {
 	builder := emit.ClientBuilder(session).
 		// Ja3(ja3).
 		Proxies(proxies).
@@ -266,7 +271,20 @@ label:
 	}
 
 	responses = append(responses, response)
-	buffer, err = io.ReadAll(response.Body)
+	if limit >= 0 && response.ContentLength > limit {
+		err = fmt.Errorf("file size %d exceeds %d", response.ContentLength, limit)
+		return
+	}
+
+	var reader io.Reader = response.Body
+	if limit >= 0 {
+		reader = io.LimitReader(response.Body, limit+1)
+	}
+	buffer, err = io.ReadAll(reader)
+	if err == nil && limit >= 0 && int64(len(buffer)) > limit {
+		err = fmt.Errorf("file size exceeds %d", limit)
+		return
+	}
 	if err != nil {
 		if retry > 0 {
 			time.Sleep(time.Second)
@@ -0,0 +1,384 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/logger"
+	"github.com/bincooo/emit.io"
+)
+
+const protocolVersion = "2024-11-05"
+
+type rpcRequest struct {
+	Jsonrpc string      `json:"jsonrpc"`
+	Id      *int64      `json:"id,omitempty"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	Id      *int64          `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("mcp error %d: %s", e.Code, e.Message)
+}
+
+// 传输层：stdio 子进程或 streamable http
+type transport interface {
+	call(ctx context.Context, req rpcRequest) (*rpcResponse, error)
+	notify(ctx context.Context, req rpcRequest) error
+	close() error
+}
+
+type Tool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"inputSchema,omitempty"`
+}
+
+type client struct {
+	name string
+	seq  atomic.Int64
+	t    transport
+}
+
+func (c *client) request(ctx context.Context, method string, params interface{}, result interface{}) error {
+	id := c.seq.Add(1)
+	res, err := c.t.call(ctx, rpcRequest{Jsonrpc: "2.0", Id: &id, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	if res.Error != nil {
+		return res.Error
+	}
+	if result == nil || len(res.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(res.Result, result)
+}
+
+func (c *client) initialize(ctx context.Context) error {
+	params := map[string]interface{}{
+		"protocolVersion": protocolVersion,
+		"capabilities":    map[string]interface{}{},
+		"clientInfo": map[string]interface{}{
+			"name":    "chatgpt-adapter",
+			"version": "1.0.0",
+		},
+	}
+	if err := c.request(ctx, "initialize", params, nil); err != nil {
+		return err
+	}
+	return c.t.notify(ctx, rpcRequest{Jsonrpc: "2.0", Method: "notifications/initialized"})
+}
+
+func (c *client) listTools(ctx context.Context) (tools []Tool, err error) {
+	cursor := ""
+	for {
+		var result struct {
+			Tools      []Tool `json:"tools"`
+			NextCursor string `json:"nextCursor"`
+		}
+
+		var params interface{}
+		if cursor != "" {
+			params = map[string]interface{}{"cursor": cursor}
+		}
+		if err = c.request(ctx, "tools/list", params, &result); err != nil {
+			return
+		}
+
+		tools = append(tools, result.Tools...)
+		if result.NextCursor == "" {
+			return
+		}
+		cursor = result.NextCursor
+	}
+}
+
+// 调用工具，文本内容拼接返回；isError 的结果同样作为文本交给模型处理
+func (c *client) callTool(ctx context.Context, name string, args map[string]interface{}) (string, error) {
+	var result struct {
+		Content []struct {
+			Type     string `json:"type"`
+			Text     string `json:"text"`
+			MimeType string `json:"mimeType"`
+			Resource *struct {
+				Uri  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"resource"`
+		} `json:"content"`
+		IsError bool `json:"isError"`
+	}
+
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	err := c.request(ctx, "tools/call", map[string]interface{}{"name": name, "arguments": args}, &result)
+	if err != nil {
+		return "", err
+	}
+
+	var slice []string
+	for _, content := range result.Content {
+		switch content.Type {
+		case "text":
+			slice = append(slice, content.Text)
+		case "resource":
+			if content.Resource != nil {
+				slice = append(slice, content.Resource.Text)
+			}
+		default:
+			slice = append(slice, fmt.Sprintf("[%s %s]", content.Type, content.MimeType))
+		}
+	}
+
+	text := strings.Join(slice, "\n")
+	if result.IsError {
+		text = "Error: " + text
+	}
+	return text, nil
+}
+
+// ==== stdio ====
+
+type stdioTransport struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+
+	mu      sync.Mutex
+	pending map[int64]chan *rpcResponse
+	done    chan struct{}
+}
+
+func newStdio(name, command string, args []string, environ map[string]string) (*stdioTransport, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Env = os.Environ()
+	for k, v := range environ {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	t := &stdioTransport{
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: make(map[int64]chan *rpcResponse),
+		done:    make(chan struct{}),
+	}
+	go t.read(name, stdout)
+	return t, nil
+}
+
+func (t *stdioTransport) read(name string, stdout io.Reader) {
+	defer close(t.done)
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var res rpcResponse
+		if err := json.Unmarshal(line, &res); err != nil {
+			logger.Warnf("mcp server '%s' invalid message: %s", name, line)
+			continue
+		}
+		// 服务端发来的通知或请求不处理
+		if res.Id == nil || res.Method != "" {
+			continue
+		}
+
+		t.mu.Lock()
+		ch, ok := t.pending[*res.Id]
+		delete(t.pending, *res.Id)
+		t.mu.Unlock()
+		if ok {
+			ch <- &res
+		}
+	}
+	logger.Warnf("mcp server '%s' stdout closed", name)
+}
+
+func (t *stdioTransport) write(req rpcRequest) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err = t.stdin.Write(append(data, '\n'))
+	return err
+}
+
+func (t *stdioTransport) call(ctx context.Context, req rpcRequest) (*rpcResponse, error) {
+	ch := make(chan *rpcResponse, 1)
+	t.mu.Lock()
+	t.pending[*req.Id] = ch
+	t.mu.Unlock()
+
+	if err := t.write(req); err != nil {
+		t.mu.Lock()
+		delete(t.pending, *req.Id)
+		t.mu.Unlock()
+		return nil, err
+	}
+
+	select {
+	case res := <-ch:
+		return res, nil
+	case <-t.done:
+		return nil, errors.New("mcp server exited")
+	case <-ctx.Done():
+		t.mu.Lock()
+		delete(t.pending, *req.Id)
+		t.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+func (t *stdioTransport) notify(_ context.Context, req rpcRequest) error {
+	return t.write(req)
+}
+
+func (t *stdioTransport) close() error {
+	_ = t.stdin.Close()
+	if t.cmd.Process != nil {
+		_ = t.cmd.Process.Kill()
+	}
+	// 主动 kill 的退出状态无需关心
+	_ = t.cmd.Wait()
+	return nil
+}
+
+// ==== http ====
+
+type httpTransport struct {
+	url     string
+	headers map[string]string
+
+	mu      sync.Mutex
+	session string
+}
+
+func (t *httpTransport) getSession() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.session
+}
+
+func (t *httpTransport) setSession(session string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.session = session
+}
+
+func (t *httpTransport) post(ctx context.Context, req rpcRequest) (*http.Response, error) {
+	builder := emit.ClientBuilder(common.NopHTTPClient).
+		Context(ctx).
+		POST(t.url).
+		JSONHeader().
+		Header("accept", "application/json, text/event-stream").
+		Headers(t.headers)
+	if session := t.getSession(); session != "" {
+		builder.Header("mcp-session-id", session)
+	}
+
+	res, err := builder.Body(req).DoC(func(res *http.Response) error {
+		if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusAccepted {
+			return emit.Error{Code: res.StatusCode, Bus: "Status", Err: errors.New(res.Status)}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if session := res.Header.Get("mcp-session-id"); session != "" {
+		t.setSession(session)
+	}
+	return res, nil
+}
+
+func (t *httpTransport) call(ctx context.Context, req rpcRequest) (*rpcResponse, error) {
+	res, err := t.post(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	// 返回可能是单个 JSON，也可能是 SSE 流
+	if !strings.Contains(res.Header.Get("content-type"), "text/event-stream") {
+		var r rpcResponse
+		if err = json.NewDecoder(res.Body).Decode(&r); err != nil {
+			return nil, err
+		}
+		return &r, nil
+	}
+
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		var r rpcResponse
+		if err = json.Unmarshal([]byte(strings.TrimSpace(line[5:])), &r); err != nil {
+			continue
+		}
+		if r.Id != nil && *r.Id == *req.Id && r.Method == "" {
+			return &r, nil
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("mcp response not found")
+}
+
+func (t *httpTransport) notify(ctx context.Context, req rpcRequest) error {
+	res, err := t.post(ctx, req)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+func (t *httpTransport) close() error { return nil }
@@ -0,0 +1,214 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/logger"
+	"github.com/iocgo/sdk/env"
+)
+
+// MCP 服务配置：
+//
+//	mcp:
+//	  max-iterations: 5   # 服务端工具循环的最大轮数
+//	  timeout: 60s        # 单次工具调用超时
+//	  models: [ "gpt-4o*" ] # 请求未携带 tools 时也注入 MCP 工具的模型，支持通配符；默认只在请求携带 tools 时注入
+//	  servers:
+//	    - name: fs
+//	      command: npx
+//	      args: [ "-y", "@modelcontextprotocol/server-filesystem", "/tmp" ]
+//	      env: { KEY: value }
+//	    - name: remote
+//	      url: http://127.0.0.1:8000/mcp
+//	      headers: { authorization: Bearer xxx }
+type serverObj struct {
+	Name    string            `mapstructure:"name"`
+	Command string            `mapstructure:"command"`
+	Args    []string          `mapstructure:"args"`
+	Env     map[string]string `mapstructure:"env"`
+	Url     string            `mapstructure:"url"`
+	Headers map[string]string `mapstructure:"headers"`
+}
+
+type toolObj struct {
+	Tool
+	client *client
+}
+
+var (
+	mu      sync.RWMutex
+	clients []*client
+	tools   = make(map[string]*toolObj)
+	names   []string
+
+	maxIterations = 5
+	timeout       = 60 * time.Second
+	models        []string
+)
+
+func init() {
+	inited.AddExited(func(*env.Environment) { Close() })
+	inited.AddInitialized(func(env *env.Environment) {
+		var servers []serverObj
+		if err := env.UnmarshalKey("mcp.servers", &servers); err != nil {
+			logger.Fatal(err)
+		}
+		if len(servers) == 0 {
+			return
+		}
+
+		if env.IsSet("mcp.max-iterations") {
+			maxIterations = env.GetInt("mcp.max-iterations")
+		}
+		if value := env.GetDuration("mcp.timeout"); value > 0 {
+			timeout = value
+		}
+		models = env.GetStringSlice("mcp.models")
+
+		for i, server := range servers {
+			if server.Name == "" {
+				server.Name = fmt.Sprintf("mcp-%d", i)
+			}
+			if server.Command == "" && server.Url == "" {
+				logger.Fatalf("mcp.servers[%d]: command or url is required", i)
+			}
+
+			// 单个服务不可用时不影响启动
+			if err := connect(server); err != nil {
+				logger.Errorf("mcp server '%s' connect failed: %v", server.Name, err)
+			}
+		}
+	})
+}
+
+func connect(server serverObj) (err error) {
+	var t transport
+	if server.Command != "" {
+		t, err = newStdio(server.Name, server.Command, server.Args, server.Env)
+		if err != nil {
+			return
+		}
+	} else {
+		t = &httpTransport{url: server.Url, headers: server.Headers}
+	}
+
+	c := &client{name: server.Name, t: t}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err = c.initialize(ctx); err != nil {
+		_ = t.close()
+		return
+	}
+
+	slice, err := c.listTools(ctx)
+	if err != nil {
+		_ = t.close()
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	clients = append(clients, c)
+	for _, tool := range slice {
+		if _, ok := tools[tool.Name]; ok {
+			logger.Warnf("mcp tool '%s' of server '%s' is duplicated, ignored", tool.Name, server.Name)
+			continue
+		}
+		tools[tool.Name] = &toolObj{tool, c}
+		names = append(names, tool.Name)
+	}
+	logger.Infof("mcp server '%s' connected, %d tools", server.Name, len(slice))
+	return
+}
+
+func Close() {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, c := range clients {
+		if err := c.t.close(); err != nil {
+			logger.Warnf("mcp server '%s' closed: %v", c.name, err)
+		}
+	}
+	clients = nil
+	tools = make(map[string]*toolObj)
+	names = nil
+}
+
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return len(tools) > 0
+}
+
+// 未携带 tools 的请求是否注入 MCP 工具
+func Always(mod string) bool {
+	for _, pattern := range models {
+		if ok, _ := path.Match(pattern, mod); ok || pattern == mod {
+			return true
+		}
+	}
+	return false
+}
+
+func MaxIterations() int {
+	return maxIterations
+}
+
+func Has(name string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	_, ok := tools[name]
+	return ok
+}
+
+// 转换为 openai 格式的工具定义
+func Tools() (slice []model.Keyv[interface{}]) {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, name := range names {
+		tool := tools[name]
+		parameters := tool.InputSchema
+		if parameters == nil {
+			parameters = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+		slice = append(slice, model.Keyv[interface{}]{
+			"type": "function",
+			"function": map[string]interface{}{
+				"name":        tool.Name,
+				"description": tool.Description,
+				"parameters":  parameters,
+			},
+		})
+	}
+	return
+}
+
+// 执行工具调用，arguments 为 JSON 字符串
+func Call(ctx context.Context, name, arguments string) (string, error) {
+	mu.RLock()
+	tool, ok := tools[name]
+	mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("mcp tool '%s' not found", name)
+	}
+
+	var args map[string]interface{}
+	if arguments != "" {
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			return "", fmt.Errorf("mcp tool '%s' invalid arguments: %v", name, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	logger.Infof("mcp call tool '%s' of server '%s': %s", name, tool.client.name, arguments)
+	return tool.client.callTool(ctx, name, args)
+}
@@ -0,0 +1,138 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// 设置该环境变量时测试程序作为 stdio MCP 服务运行：1 正常服务，exit 启动后立即退出
+const stubEnv = "MCP_STUB_SERVER"
+
+func TestMain(m *testing.M) {
+	switch os.Getenv(stubEnv) {
+	case "1":
+		serveStub()
+		os.Exit(0)
+	case "exit":
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// 提供 add 与 fail 两个工具的最小 MCP 服务
+func serveStub() {
+	scanner := bufio.NewScanner(os.Stdin)
+	encoder := json.NewEncoder(os.Stdout)
+	for scanner.Scan() {
+		var req struct {
+			Id     *int64 `json:"id"`
+			Method string `json:"method"`
+			Params struct {
+				Name      string             `json:"name"`
+				Arguments map[string]float64 `json:"arguments"`
+			} `json:"params"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &req) != nil || req.Id == nil {
+			continue
+		}
+
+		var result interface{}
+		switch req.Method {
+		case "initialize":
+			result = map[string]interface{}{"protocolVersion": protocolVersion, "capabilities": map[string]interface{}{}}
+		case "tools/list":
+			result = map[string]interface{}{"tools": []interface{}{
+				map[string]interface{}{"name": "add", "description": "add two numbers", "inputSchema": map[string]interface{}{
+					"type":       "object",
+					"properties": map[string]interface{}{"a": map[string]interface{}{"type": "number"}, "b": map[string]interface{}{"type": "number"}},
+				}},
+				map[string]interface{}{"name": "fail"},
+			}}
+		case "tools/call":
+			if req.Params.Name == "fail" {
+				result = map[string]interface{}{"isError": true, "content": []interface{}{map[string]interface{}{"type": "text", "text": "boom"}}}
+				break
+			}
+			sum := req.Params.Arguments["a"] + req.Params.Arguments["b"]
+			result = map[string]interface{}{"content": []interface{}{map[string]interface{}{"type": "text", "text": fmt.Sprint(sum)}}}
+		default:
+			_ = encoder.Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.Id, "error": map[string]interface{}{"code": -32601, "message": "method not found"}})
+			continue
+		}
+		// 先发一条通知，客户端应忽略
+		_ = encoder.Encode(map[string]interface{}{"jsonrpc": "2.0", "method": "notifications/message"})
+		_ = encoder.Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.Id, "result": result})
+	}
+}
+
+func TestStdioServer(t *testing.T) {
+	err := connect(serverObj{Name: "stub", Command: os.Args[0], Env: map[string]string{stubEnv: "1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+
+	if !Enabled() || !Has("add") || !Has("fail") || Has("sub") {
+		t.Fatalf("tools = %v", names)
+	}
+
+	slice := Tools()
+	if len(slice) != 2 || slice[0].GetKeyv("function").GetString("name") != "add" {
+		t.Fatalf("Tools() = %v", slice)
+	}
+	if parameters := slice[1].GetKeyv("function").GetKeyv("parameters"); parameters.GetString("type") != "object" {
+		t.Errorf("tool without inputSchema has parameters %v", parameters)
+	}
+
+	tests := []struct {
+		name      string
+		tool      string
+		arguments string
+		want      string
+		ok        bool
+	}{
+		{"call", "add", `{"a":1,"b":2}`, "3", true},
+		{"no arguments", "add", "", "0", true},
+		{"tool error", "fail", "{}", "Error: boom", true},
+		{"invalid arguments", "add", `{"a":`, "", false},
+		{"unknown tool", "sub", "{}", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := Call(context.Background(), tt.tool, tt.arguments)
+			if (err == nil) != tt.ok {
+				t.Fatalf("Call() error = %v, want ok %v", err, tt.ok)
+			}
+			if content != tt.want {
+				t.Errorf("Call() = %q, want %q", content, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlways(t *testing.T) {
+	defer func(saved []string) { models = saved }(models)
+	models = []string{"gpt-4o*", "deepseek/v3"}
+
+	for mod, want := range map[string]bool{"gpt-4o": true, "gpt-4o-mini": true, "deepseek/v3": true, "claude": false} {
+		if got := Always(mod); got != want {
+			t.Errorf("Always(%q) = %v, want %v", mod, got, want)
+		}
+	}
+}
+
+func TestStdioServerExited(t *testing.T) {
+	err := connect(serverObj{Name: "exit", Command: os.Args[0], Env: map[string]string{stubEnv: "exit"}})
+	if err == nil {
+		Close()
+		t.Fatal("connect() succeeded with an exited server")
+	}
+	if Enabled() {
+		t.Error("tools of the exited server are registered")
+	}
+}
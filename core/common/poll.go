@@ -2,7 +2,6 @@ package common
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
@@ -10,6 +9,7 @@ import (
 
 	"chatgpt-adapter/core/logger"
 	"github.com/iocgo/sdk/lock"
+	"github.com/patrickmn/go-cache"
 )
 
 const (
@@ -19,6 +19,7 @@ const (
 type state struct {
 	t time.Time
 	s byte
+	u time.Time // 指定的冷却截止时间，为空时按 resetTime 复位
 }
 
 type PollContainer[T interface{}] struct {
@@ -26,29 +27,52 @@ type PollContainer[T interface{}] struct {
 	pos       int
 	slice     []T
 	markers   map[interface{}]*state
+	resetTime time.Duration
 	mu        *lock.ExpireLock // mark
 	cmu       *lock.ExpireLock // delete
 	Condition func(T) bool
+	Weight    func(T) int // weighted 策略使用的容量
+
+	strategy string
+	used     map[string]time.Time // lru 最近使用时间
+	weights  map[string]int       // weighted 当前权重
+	sessions *cache.Cache         // sticky 会话绑定
+
+	file  string // 状态持久化文件
+	saveC chan struct{}
 }
 
-// resetTime 用于复位状态：0 就绪状态，1 使用状态，2 异常状态
+// resetTime 用于复位状态：0 就绪状态，1 使用状态，2 异常状态，3 停用状态
 func NewPollContainer[T interface{}](name string, slice []T, resetTime time.Duration) *PollContainer[T] {
 	container := PollContainer[T]{
-		name:    name,
-		slice:   slice,
-		markers: make(map[interface{}]*state),
+		name:      name,
+		slice:     slice,
+		markers:   make(map[interface{}]*state),
+		resetTime: resetTime,
 
 		mu:  lock.NewExpireLock(true),
 		cmu: lock.NewExpireLock(true),
+
+		strategy: pollStrategy(name),
+		used:     make(map[string]time.Time),
+		weights:  make(map[string]int),
+		sessions: newSessions(),
+
+		file:  pollStateFile(name),
+		saveC: make(chan struct{}, 1),
 	}
 
-	if resetTime > 0 {
-		go timer(&container, resetTime)
+	logger.Infof("[%s] PollContainer 选择策略: %s", name, container.strategy)
+	container.restore()
+	if container.file != "" {
+		go container.saver()
 	}
+
+	go timer(&container, resetTime)
 	return &container
 }
 
-// 定时复位状态 0 就绪状态，1 使用状态，2 异常状态
+// 定时复位状态 1 使用状态，2 异常状态，3 停用状态；停用状态只在指定的截止时间后复位
 func timer[T interface{}](container *PollContainer[T], resetTime time.Duration) {
 	s10 := 10 * time.Second
 	s20 := 20 * time.Second
@@ -67,36 +91,43 @@ func timer[T interface{}](container *PollContainer[T], resetTime time.Duration)
 		}
 		cancel()
 
+		changed := false
 		for _, value := range container.slice {
-			var obj interface{} = value
-			if s, ok := obj.(string); ok {
-				obj = s
-			} else {
-				data, _ := json.Marshal(obj)
-				obj = string(data)
-			}
-
+			obj := markerKey(value)
 			marker, ok := container.markers[obj]
 			if !ok {
 				continue
 			}
 
-			if marker.s == 0 { // 就绪状态
+			if marker.s == 0 || marker.s == 3 && marker.u.IsZero() {
 				continue
 			}
 
-			// 1 使用中 2 异常冷却中
-			if time.Now().Add(-resetTime).After(marker.t) {
+			// 1 使用中 2 异常冷却中 3 停用中
+			expired := !marker.u.IsZero() && time.Now().After(marker.u)
+			if marker.u.IsZero() && resetTime > 0 {
+				expired = time.Now().Add(-resetTime).After(marker.t)
+			}
+			if expired {
 				marker.s = 0
-				logger.Infof("[%s] PollContainer 冷却完毕: %v", container.name, obj)
+				changed = true
+				logger.Infof("[%s] PollContainer 冷却完毕: %s", container.name, CalcHex(obj)[:8])
 			}
 		}
 		container.mu.Unlock()
+		if changed {
+			container.persist()
+		}
 		time.Sleep(s10)
 	}
 }
 
 func (container *PollContainer[T]) Poll() (T, error) {
+	return container.PollWith("")
+}
+
+// 按配置的策略选取，key 为会话标识，仅 sticky 策略使用
+func (container *PollContainer[T]) PollWith(key string) (T, error) {
 	var zero T
 	if container == nil || len(container.slice) == 0 {
 		return zero, errors.New("no elements in slice")
@@ -114,31 +145,29 @@ func (container *PollContainer[T]) Poll() (T, error) {
 	}
 	defer container.cmu.Unlock()
 
-	pos := container.pos
-	sliceL := len(container.slice)
-	if pos >= sliceL {
-		container.pos = 0
-		pos = 0
+	var selected int
+	switch container.strategy {
+	case StrategyLRU:
+		selected = container.leastRecentlyUsed()
+	case StrategyWeighted:
+		selected = container.weighted()
+	case StrategySticky:
+		selected = container.sticky(key)
+	default:
+		selected = container.roundRobin()
 	}
 
-	for index := 0; index < sliceL; index++ {
-		curr := pos + index
-		if curr >= sliceL {
-			curr = curr - sliceL
-		}
-
-		value := container.slice[curr]
-		if container.Condition(value) {
-			container.pos = curr + 1
-			err := container.MarkTo(value, 1)
-			if err != nil {
-				return zero, err
-			}
-			return value, nil
-		}
+	if selected < 0 {
+		return zero, fmt.Errorf("not roll result")
 	}
 
-	return zero, fmt.Errorf("not roll result")
+	value := container.slice[selected]
+	container.pos = selected + 1
+	container.used[markerKey(value)] = time.Now()
+	if err := container.MarkTo(value, 1); err != nil {
+		return zero, err
+	}
+	return value, nil
 }
 
 func (container *PollContainer[T]) Remove(value T) (err error) {
@@ -160,32 +189,56 @@ func (container *PollContainer[T]) Remove(value T) (err error) {
 			break
 		}
 	}
+	container.clear(value)
 	return
 }
 
+// 重新添加的凭证清除之前的状态
 func (container *PollContainer[T]) Add(value T) {
 	container.slice = append(container.slice, value)
+	container.clear(value)
 }
 
-// 标记： 0 就绪状态，1 使用状态，2 异常状态
-func (container *PollContainer[T]) MarkTo(key interface{}, value byte) error {
-	if s, ok := key.(string); ok {
-		key = s
-	} else {
-		data, _ := json.Marshal(key)
-		key = string(data)
+func (container *PollContainer[T]) clear(value T) {
+	timeout, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+
+	if !container.mu.Lock(timeout) {
+		logger.Errorf("[%s] PollContainer 获取锁失败", container.name)
+		return
 	}
+	delete(container.markers, markerKey(value))
+	container.mu.Unlock()
+	container.persist()
+}
+
+// 标记： 0 就绪状态，1 使用状态，2 异常状态，3 停用状态
+func (container *PollContainer[T]) MarkTo(key interface{}, value byte) error {
+	return container.mark(key, value, time.Time{})
+}
+
+// 进入异常状态，冷却指定时长后复位
+func (container *PollContainer[T]) Cooldown(key interface{}, duration time.Duration) error {
+	return container.mark(key, 2, time.Now().Add(duration))
+}
+
+func (container *PollContainer[T]) mark(key interface{}, value byte, until time.Time) error {
+	key = markerKey(key)
 
 	timeout, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	if container.mu.Lock(timeout) {
+		defer container.persist()
 		defer container.mu.Unlock()
 		container.markers[key] = &state{
 			t: time.Now(),
 			s: value,
+			u: until,
 		}
-		if value == 1 {
+		if !until.IsZero() {
+			logger.Infof("[%s] 设置状态值：%d，冷却至 %s", container.name, value, until.Format(time.DateTime))
+		} else if value == 1 {
 			logger.Infof("[%s] 索引 [%d] 设置状态值：%d", container.name, container.pos, value)
 		} else {
 			logger.Infof("[%s] 设置状态值：%d", container.name, value)
@@ -197,12 +250,7 @@ func (container *PollContainer[T]) MarkTo(key interface{}, value byte) error {
 }
 
 func (container *PollContainer[T]) Marked(key interface{}) (byte, error) {
-	if s, ok := key.(string); ok {
-		key = s
-	} else {
-		data, _ := json.Marshal(key)
-		key = string(data)
-	}
+	key = markerKey(key)
 
 	timeout, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
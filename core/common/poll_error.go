@@ -0,0 +1,217 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"chatgpt-adapter/core/logger"
+	"github.com/bincooo/emit.io"
+	"github.com/iocgo/sdk/env"
+)
+
+// 错误处理动作
+type ErrorAction byte
+
+const (
+	ActionNone          ErrorAction = iota // 与账号无关的错误，不处理
+	ActionRetry                            // 偶发错误，不冷却，换账号重试
+	ActionShortCooldown                    // 限流，短时冷却
+	ActionLongCooldown                     // 额度耗尽、人机验证，长时冷却
+	ActionDisable                          // 凭证失效，停用至 disable-cooldown 到期
+)
+
+func (action ErrorAction) String() string {
+	switch action {
+	case ActionRetry:
+		return "retry"
+	case ActionShortCooldown:
+		return "short-cooldown"
+	case ActionLongCooldown:
+		return "long-cooldown"
+	case ActionDisable:
+		return "disable"
+	default:
+		return "none"
+	}
+}
+
+type ErrorClass struct {
+	Action     ErrorAction
+	RetryAfter time.Duration // 上游给出的等待时间，优先于配置的冷却时间
+}
+
+// 携带 Retry-After 的错误，由持有响应头的调用方包装
+type RetryAfterError struct {
+	Err   error
+	After time.Duration
+}
+
+func (e *RetryAfterError) Error() string { return e.Err.Error() }
+func (e *RetryAfterError) Unwrap() error { return e.Err }
+
+// 读取响应头中的 Retry-After（秒数或 HTTP 日期）并包装错误
+func WithRetryAfter(err error, header http.Header) error {
+	if err == nil || header == nil {
+		return err
+	}
+	if after := parseRetryAfter(header.Get("Retry-After")); after > 0 {
+		return &RetryAfterError{err, after}
+	}
+	return err
+}
+
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
+
+var (
+	retryAfterRegexp = regexp.MustCompile(`(?i)(?:retry[ -]after|try again in)[ :]*(\d+)\s*(s|sec|seconds?|m|min|minutes?|h|hours?)?`)
+
+	// 上游响应体中已知的错误文案，按顺序匹配；凭证失效只看状态码
+	errorMessages = []struct {
+		action   ErrorAction
+		keywords []string
+	}{
+		{ActionLongCooldown, []string{"zero quota", "quota exceeded", "insufficient quota", "insufficient credit", "out of credits", "daily limit", "usage limit", "captcha", "verify you are human"}},
+		{ActionShortCooldown, []string{"rate limit", "too many requests", "throttl"}},
+	}
+)
+
+// 将上游错误归类为账号处理动作：
+// 401 停用，402 / 403 长冷却，429 短冷却，5xx / 网络错误换账号重试；
+// 4xx 响应体中已知的额度、验证码文案优先于状态码。
+// 非 HTTP 错误（如 you.com 的 ZERO QUOTA）只按已知文案匹配，其余本地错误（配置缺失、参数校验等）不处理
+func ClassifyError(err error) (class ErrorClass) {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+
+	var rae *RetryAfterError
+	if errors.As(err, &rae) {
+		class.RetryAfter = rae.After
+	}
+
+	var se emit.Error
+	isHTTP := errors.As(err, &se)
+	message := strings.ToLower(err.Error())
+	if isHTTP {
+		message = strings.ToLower(se.Msg)
+	}
+
+	if class.RetryAfter == 0 && message != "" {
+		if matches := retryAfterRegexp.FindStringSubmatch(message); len(matches) > 1 {
+			value, _ := strconv.Atoi(matches[1])
+			unit := time.Second
+			switch {
+			case strings.HasPrefix(matches[2], "m"):
+				unit = time.Minute
+			case strings.HasPrefix(matches[2], "h"):
+				unit = time.Hour
+			}
+			class.RetryAfter = time.Duration(value) * unit
+		}
+	}
+
+	if !isHTTP || (se.Code >= 400 && se.Code < 500 && se.Code != http.StatusUnauthorized) {
+		if class.Action = matchMessage(message); class.Action != ActionNone || !isHTTP {
+			return
+		}
+	}
+
+	switch {
+	case se.Code == http.StatusUnauthorized:
+		class.Action = ActionDisable
+	case se.Code == http.StatusPaymentRequired || se.Code == http.StatusForbidden:
+		class.Action = ActionLongCooldown
+	case se.Code == http.StatusTooManyRequests:
+		class.Action = ActionShortCooldown
+	case se.Code >= 500:
+		class.Action = ActionRetry
+	case se.Code == -1 && se.Bus != "":
+		// 请求失败或响应类型不符（如返回了验证页面），Bus 为空的是本地构造的错误
+		class.Action = ActionRetry
+	}
+	return
+}
+
+func matchMessage(message string) ErrorAction {
+	for _, item := range errorMessages {
+		for _, keyword := range item.keywords {
+			if strings.Contains(message, keyword) {
+				return item.action
+			}
+		}
+	}
+	return ActionNone
+}
+
+// 换账号重试的最大次数，poll.retries 默认 2
+func PollRetries() int {
+	if env.Env == nil || !env.Env.IsSet("poll.retries") {
+		return 2
+	}
+	return env.Env.GetInt("poll.retries")
+}
+
+// 按分类结果更新账号状态，返回是否可以换账号重试。
+// 冷却时长：poll.<name>.short-cooldown 默认 60s，poll.<name>.long-cooldown 默认为容器的复位时间，
+// poll.<name>.disable-cooldown 默认 24h，到期后重新启用；从配置中移除或重新添加凭证会清除其状态
+func (container *PollContainer[T]) HandleError(value T, err error) bool {
+	class := ClassifyError(err)
+	if class.Action == ActionNone {
+		return false
+	}
+
+	var e error
+	switch class.Action {
+	case ActionShortCooldown, ActionLongCooldown:
+		cooldown := class.RetryAfter
+		if cooldown <= 0 {
+			cooldown = container.cooldown(class.Action)
+		}
+		e = container.Cooldown(value, cooldown)
+	case ActionDisable:
+		e = container.mark(value, 3, time.Now().Add(container.cooldown(class.Action)))
+	}
+	if e != nil {
+		logger.Error(e)
+	}
+
+	logger.Infof("[%s] PollContainer 错误处理: %s, %v", container.name, class.Action, err)
+	return true
+}
+
+func (container *PollContainer[T]) cooldown(action ErrorAction) time.Duration {
+	key, def := "short-cooldown", time.Minute
+	switch action {
+	case ActionLongCooldown:
+		key, def = "long-cooldown", container.resetTime
+	case ActionDisable:
+		key, def = "disable-cooldown", 24*time.Hour
+	}
+
+	if env.Env != nil {
+		if value := env.Env.GetDuration("poll." + container.name + "." + key); value > 0 {
+			return value
+		}
+	}
+	if def <= 0 {
+		def = time.Hour
+	}
+	return def
+}
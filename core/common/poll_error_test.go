@@ -0,0 +1,50 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bincooo/emit.io"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		action ErrorAction
+		after  time.Duration
+	}{
+		{"nil", nil, ActionNone, 0},
+		{"canceled", fmt.Errorf("request: %w", context.Canceled), ActionNone, 0},
+		{"local error", errors.New("please config bing.cookies"), ActionNone, 0},
+		{"plain quota error", errors.New("ZERO QUOTA"), ActionLongCooldown, 0},
+		{"plain rate limit", errors.New("error: rate limit, try again in 2 minutes"), ActionShortCooldown, 2 * time.Minute},
+		{"unauthorized", emit.Error{Code: http.StatusUnauthorized, Bus: "Status", Msg: "unauthorized"}, ActionDisable, 0},
+		{"forbidden", emit.Error{Code: http.StatusForbidden, Bus: "Status"}, ActionLongCooldown, 0},
+		{"too many requests", emit.Error{Code: http.StatusTooManyRequests, Bus: "Status"}, ActionShortCooldown, 0},
+		{"quota in 400 body", emit.Error{Code: http.StatusBadRequest, Bus: "Status", Msg: `{"error":"insufficient quota"}`}, ActionLongCooldown, 0},
+		{"plain 400", emit.Error{Code: http.StatusBadRequest, Bus: "Status", Msg: "bad request"}, ActionNone, 0},
+		{"server error", emit.Error{Code: http.StatusBadGateway, Bus: "Status"}, ActionRetry, 0},
+		{"transport error", emit.Error{Code: -1, Bus: "Do", Msg: "connection reset"}, ActionRetry, 0},
+		{"local emit error", emit.Error{Code: -1, Msg: "invalid"}, ActionNone, 0},
+		{
+			"retry-after header",
+			WithRetryAfter(emit.Error{Code: http.StatusTooManyRequests, Bus: "Status"}, http.Header{"Retry-After": {"30"}}),
+			ActionShortCooldown,
+			30 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			class := ClassifyError(tt.err)
+			if class.Action != tt.action || class.RetryAfter != tt.after {
+				t.Errorf("ClassifyError() = %s, %v, want %s, %v", class.Action, class.RetryAfter, tt.action, tt.after)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"chatgpt-adapter/core/logger"
+	"github.com/iocgo/sdk/env"
+)
+
+// 状态持久化配置，重启后恢复冷却中的账号：
+//
+//	poll:
+//	  persist: true       # 默认开启
+//	  dir: data/poll      # 每个容器一个 <name>.json，以凭证的哈希为键，不保存凭证原文
+type persistedState struct {
+	T time.Time `json:"t"`
+	S byte      `json:"s"`
+	U time.Time `json:"u"`
+}
+
+func pollStateFile(name string) string {
+	if env.Env == nil {
+		return ""
+	}
+	if env.Env.IsSet("poll.persist") && !env.Env.GetBool("poll.persist") {
+		return ""
+	}
+
+	dir := env.Env.GetString("poll.dir")
+	if dir == "" {
+		dir = "data/poll"
+	}
+	return filepath.Join(dir, name+".json")
+}
+
+// 读取上次保存的状态；使用中的状态无法延续，按就绪处理；已从配置中移除的凭证丢弃其状态
+func (container *PollContainer[T]) restore() {
+	if container.file == "" {
+		return
+	}
+
+	data, err := os.ReadFile(container.file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warnf("[%s] PollContainer 读取状态失败: %v", container.name, err)
+		}
+		return
+	}
+
+	var states map[string]persistedState
+	if err = json.Unmarshal(data, &states); err != nil {
+		logger.Warnf("[%s] PollContainer 解析状态失败: %v", container.name, err)
+		return
+	}
+
+	// 哈希 => 凭证
+	keys := make(map[string]string, len(container.slice))
+	for _, value := range container.slice {
+		key := markerKey(value)
+		keys[CalcHex(key)] = key
+	}
+
+	count := 0
+	for hash, value := range states {
+		key, ok := keys[hash]
+		if !ok {
+			delete(states, hash)
+			continue
+		}
+		if value.S == 1 {
+			value.S = 0
+		}
+		// 未指定期限的停用状态
+		if value.S == 3 && value.U.IsZero() {
+			value.U = value.T.Add(container.cooldown(ActionDisable))
+		}
+		if value.S != 0 {
+			count++
+		}
+		container.markers[key] = &state{t: value.T, s: value.S, u: value.U}
+	}
+	logger.Infof("[%s] PollContainer 恢复状态 %d 条，冷却中 %d 条", container.name, len(states), count)
+}
+
+// 通知后台协程保存，多次变更合并为一次写入
+func (container *PollContainer[T]) persist() {
+	if container.file == "" {
+		return
+	}
+	select {
+	case container.saveC <- struct{}{}:
+	default:
+	}
+}
+
+func (container *PollContainer[T]) saver() {
+	for range container.saveC {
+		if err := container.save(); err != nil {
+			logger.Warnf("[%s] PollContainer 保存状态失败: %v", container.name, err)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func (container *PollContainer[T]) save() error {
+	timeout, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+	if !container.mu.Lock(timeout) {
+		return context.DeadlineExceeded
+	}
+
+	states := make(map[string]persistedState, len(container.markers))
+	for key, marker := range container.markers {
+		if str, ok := key.(string); ok {
+			states[CalcHex(str)] = persistedState{marker.t, marker.s, marker.u}
+		}
+	}
+	container.mu.Unlock()
+
+	data, err := json.Marshal(states)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(container.file), 0755); err != nil {
+		return err
+	}
+
+	// 先写临时文件再替换，避免写一半时进程退出
+	tmp := container.file + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, container.file)
+}
@@ -0,0 +1,100 @@
+package common
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/iocgo/sdk/lock"
+)
+
+// 不启动复位与保存协程的容器
+func newTestContainer(file string, slice ...string) *PollContainer[string] {
+	return &PollContainer[string]{
+		name:      "test",
+		slice:     slice,
+		markers:   make(map[interface{}]*state),
+		resetTime: time.Hour,
+		mu:        lock.NewExpireLock(true),
+		cmu:       lock.NewExpireLock(true),
+		Condition: func(string) bool { return true },
+		strategy:  StrategyRoundRobin,
+		used:      make(map[string]time.Time),
+		weights:   make(map[string]int),
+		sessions:  newSessions(),
+		file:      file,
+		saveC:     make(chan struct{}, 1),
+	}
+}
+
+func TestPollStateRestore(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.json")
+	now := time.Now().Truncate(time.Second)
+	states := map[string]persistedState{
+		CalcHex("cooling"):  {T: now, S: 2, U: now.Add(time.Minute)},
+		CalcHex("using"):    {T: now, S: 1},
+		CalcHex("disabled"): {T: now, S: 3},
+		CalcHex("removed"):  {T: now, S: 2},
+		"plaintext":         {T: now, S: 2},
+	}
+	data, err := json.Marshal(states)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	container := newTestContainer(file, "cooling", "using", "disabled", "plaintext")
+	container.restore()
+
+	tests := []struct {
+		key    string
+		ok     bool
+		s      byte
+		cooled time.Time
+	}{
+		{"cooling", true, 2, now.Add(time.Minute)},
+		{"using", true, 0, time.Time{}},
+		{"disabled", true, 3, now.Add(24 * time.Hour)},
+		{"plaintext", false, 0, time.Time{}},
+		{"removed", false, 0, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			marker, ok := container.markers[tt.key]
+			if ok != tt.ok {
+				t.Fatalf("restored = %v, want %v", ok, tt.ok)
+			}
+			if ok && (marker.s != tt.s || !marker.u.Equal(tt.cooled)) {
+				t.Errorf("state = %d until %s, want %d until %s", marker.s, marker.u, tt.s, tt.cooled)
+			}
+		})
+	}
+}
+
+func TestPollStateSave(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "poll", "test.json")
+	container := newTestContainer(file, "sk-secret")
+	if err := container.Cooldown("sk-secret", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := container.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var states map[string]persistedState
+	if err = json.Unmarshal(data, &states); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := states[CalcHex("sk-secret")]; !ok || len(states) != 1 {
+		t.Errorf("saved states = %s, want only the credential hash", data)
+	}
+}
@@ -0,0 +1,166 @@
+package common
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/logger"
+	"github.com/iocgo/sdk/env"
+	"github.com/patrickmn/go-cache"
+)
+
+// 选择策略，按容器名配置：
+//
+//	poll:
+//	  bing:
+//	    strategy: lru           # round-robin（默认）/ lru / weighted / sticky
+//	  you:
+//	    strategy: weighted      # 权重取自各账号配置的 capacity
+//	  coze:
+//	    strategy: sticky        # 同一会话固定使用同一账号，账号不可用时重新分配
+const (
+	StrategyRoundRobin = "round-robin"
+	StrategyLRU        = "lru"
+	StrategyWeighted   = "weighted"
+	StrategySticky     = "sticky"
+)
+
+// 会话与账号的绑定在无访问 1 小时后失效
+const stickyExpiration = time.Hour
+
+func pollStrategy(name string) string {
+	if env.Env == nil {
+		return StrategyRoundRobin
+	}
+
+	strategy := strings.ToLower(env.Env.GetString("poll." + name + ".strategy"))
+	switch strategy {
+	case "":
+		return StrategyRoundRobin
+	case StrategyRoundRobin, StrategyLRU, StrategyWeighted, StrategySticky:
+		return strategy
+	default:
+		logger.Warnf("[%s] PollContainer 未知的策略: %s，使用 %s", name, strategy, StrategyRoundRobin)
+		return StrategyRoundRobin
+	}
+}
+
+// 会话标识：模型 + 首条用户消息，多轮对话中保持不变
+func ConversationKey(completion model.Completion) string {
+	for _, message := range completion.Messages {
+		if message.Is("role", "user") {
+			content := message.GetString("content")
+			if message.IsSlice("content") {
+				for _, item := range message.GetSlice("content") {
+					if kv, ok := item.(map[string]interface{}); ok && kv["type"] == "text" {
+						content += model.Keyv[interface{}](kv).GetString("text")
+					}
+				}
+			}
+			return CalcHex(completion.Model + content)
+		}
+	}
+	return ""
+}
+
+func markerKey(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// 严格轮询：从上次选中的下一个开始
+func (container *PollContainer[T]) roundRobin() int {
+	sliceL := len(container.slice)
+	if container.pos >= sliceL {
+		container.pos = 0
+	}
+
+	for index := 0; index < sliceL; index++ {
+		curr := (container.pos + index) % sliceL
+		if container.Condition(container.slice[curr]) {
+			return curr
+		}
+	}
+	return -1
+}
+
+// 最久未使用优先，从未使用过的最先
+func (container *PollContainer[T]) leastRecentlyUsed() int {
+	selected := -1
+	var oldest time.Time
+	for index, value := range container.slice {
+		if !container.Condition(value) {
+			continue
+		}
+
+		used := container.used[markerKey(value)]
+		if selected == -1 || used.Before(oldest) {
+			selected, oldest = index, used
+		}
+	}
+	return selected
+}
+
+// 平滑加权轮询，权重为 Weight 返回的容量，未设置时为 1
+func (container *PollContainer[T]) weighted() int {
+	selected, total := -1, 0
+	for index, value := range container.slice {
+		if !container.Condition(value) {
+			continue
+		}
+
+		weight := 1
+		if container.Weight != nil {
+			weight = container.Weight(value)
+		}
+		if weight <= 0 {
+			continue
+		}
+
+		key := markerKey(value)
+		container.weights[key] += weight
+		total += weight
+		if selected == -1 || container.weights[key] > container.weights[markerKey(container.slice[selected])] {
+			selected = index
+		}
+	}
+
+	if selected >= 0 {
+		container.weights[markerKey(container.slice[selected])] -= total
+	}
+	return selected
+}
+
+// 会话粘滞：已绑定且可用时沿用，否则轮询并重新绑定
+func (container *PollContainer[T]) sticky(key string) int {
+	if key == "" {
+		return container.roundRobin()
+	}
+
+	if bound, ok := container.sessions.Get(key); ok {
+		for index, value := range container.slice {
+			if markerKey(value) == bound.(string) {
+				if container.Condition(value) {
+					container.sessions.SetDefault(key, bound)
+					return index
+				}
+				break
+			}
+		}
+	}
+
+	selected := container.roundRobin()
+	if selected >= 0 {
+		container.sessions.SetDefault(key, markerKey(container.slice[selected]))
+	}
+	return selected
+}
+
+func newSessions() *cache.Cache {
+	return cache.New(stickyExpiration, 10*time.Minute)
+}
@@ -0,0 +1,136 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"chatgpt-adapter/core/gin/model"
+)
+
+// 不可用的值不参与选择
+func newStrategyContainer(strategy string, disabled map[string]bool, slice ...string) *PollContainer[string] {
+	container := newTestContainer("", slice...)
+	container.strategy = strategy
+	container.Condition = func(value string) bool { return !disabled[value] }
+	return container
+}
+
+func poll(t *testing.T, container *PollContainer[string], key string, n int) (slice []string) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		value, err := container.PollWith(key)
+		if err != nil {
+			t.Fatalf("PollWith() error = %v", err)
+		}
+		slice = append(slice, value)
+	}
+	return
+}
+
+func TestPollRoundRobin(t *testing.T) {
+	tests := []struct {
+		name     string
+		disabled map[string]bool
+		want     []string
+	}{
+		{"all", nil, []string{"a", "b", "c", "a"}},
+		{"skip unavailable", map[string]bool{"b": true}, []string{"a", "c", "a", "c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			container := newStrategyContainer(StrategyRoundRobin, tt.disabled, "a", "b", "c")
+			if got := poll(t, container, "", len(tt.want)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Poll() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	container := newStrategyContainer(StrategyRoundRobin, map[string]bool{"a": true}, "a")
+	if _, err := container.Poll(); err == nil {
+		t.Error("Poll() succeeded without available values")
+	}
+}
+
+func TestPollLRU(t *testing.T) {
+	container := newStrategyContainer(StrategyLRU, map[string]bool{"d": true}, "a", "b", "c", "d")
+	now := time.Now()
+	container.used["a"] = now
+	container.used["c"] = now.Add(-time.Hour)
+
+	// 从未使用的 b 最先，之后按最近使用时间由远到近
+	if got, want := poll(t, container, "", 4), []string{"b", "c", "a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Poll() = %v, want %v", got, want)
+	}
+}
+
+func TestPollWeighted(t *testing.T) {
+	container := newStrategyContainer(StrategyWeighted, nil, "a", "b", "c", "d")
+	weights := map[string]int{"a": 5, "b": 1, "c": 1, "d": 0}
+	container.Weight = func(value string) int { return weights[value] }
+
+	// 平滑加权：高权重的值分散在序列中，权重为 0 的不被选中
+	got := poll(t, container, "", 14)
+	want := []string{"a", "a", "b", "a", "c", "a", "a"}
+	if !reflect.DeepEqual(got, append(want, want...)) {
+		t.Errorf("Poll() = %v, want %v twice", got, want)
+	}
+}
+
+func TestPollSticky(t *testing.T) {
+	disabled := make(map[string]bool)
+	container := newStrategyContainer(StrategySticky, disabled, "a", "b", "c")
+
+	first := poll(t, container, "s1", 1)[0]
+	second := poll(t, container, "s2", 1)[0]
+	if first == second {
+		t.Fatalf("sessions share %q, want round-robin assignment", first)
+	}
+	if got := poll(t, container, "s1", 3); !reflect.DeepEqual(got, []string{first, first, first}) {
+		t.Errorf("PollWith(s1) = %v, want %q", got, first)
+	}
+
+	// 绑定的值不可用时重新分配并绑定
+	disabled[first] = true
+	rebound := poll(t, container, "s1", 1)[0]
+	if rebound == first {
+		t.Fatalf("PollWith(s1) = %q, want another value", rebound)
+	}
+	disabled[first] = false
+	if got := poll(t, container, "s1", 1)[0]; got != rebound {
+		t.Errorf("PollWith(s1) = %q, want rebound %q", got, rebound)
+	}
+
+	// 无会话标识时按轮询
+	if got := poll(t, container, "", 3); len(got) != 3 || got[0] == got[1] || got[1] == got[2] {
+		t.Errorf("Poll() = %v, want round-robin", got)
+	}
+}
+
+func TestConversationKey(t *testing.T) {
+	key := ConversationKey(completionOf("gpt", "hello"))
+	multi := completionOf("gpt", "hello")
+	multi.Messages = append(multi.Messages, model.Keyv[interface{}]{"role": "assistant", "content": "hi"}, model.Keyv[interface{}]{"role": "user", "content": "more"})
+	parts := model.Completion{Model: "gpt", Messages: []model.Keyv[interface{}]{{"role": "user", "content": []interface{}{
+		map[string]interface{}{"type": "text", "text": "hello"},
+		map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "https://example.com/a.png"}},
+	}}}}
+
+	if key == "" || ConversationKey(multi) != key || ConversationKey(parts) != key {
+		t.Error("ConversationKey() changes within the conversation")
+	}
+	if ConversationKey(completionOf("claude", "hello")) == key || ConversationKey(completionOf("gpt", "bye")) == key {
+		t.Error("ConversationKey() collides across conversations")
+	}
+	if ConversationKey(model.Completion{Model: "gpt"}) != "" {
+		t.Error("ConversationKey() without user messages is not empty")
+	}
+}
+
+func completionOf(mod, content string) model.Completion {
+	return model.Completion{Model: mod, Messages: []model.Keyv[interface{}]{
+		{"role": "system", "content": "be nice"},
+		{"role": "user", "content": content},
+	}}
+}
@@ -0,0 +1,290 @@
+package pricing
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const dayLayout = "2006-01-02"
+
+// 按 天 + 客户端 key + 模型 汇总的费用
+type Record struct {
+	Day       string  `json:"day"`
+	Key       string  `json:"key"` // 客户端 key 的哈希，不保存原文
+	Model     string  `json:"model"`
+	Requests  int     `json:"requests"`
+	Prompt    int     `json:"prompt_tokens"`
+	Output    int     `json:"completion_tokens"`
+	Cached    int     `json:"cached_tokens"`
+	Images    int     `json:"images"`
+	Estimated int     `json:"estimated_requests"` // 用量为本地估算的请求数
+	Priced    bool    `json:"priced"`             // 价格表中是否有该模型
+	Cost      float64 `json:"cost"`
+}
+
+type Usage struct {
+	Prompt    int
+	Output    int
+	Cached    int
+	Images    int
+	Estimated bool
+}
+
+type recordKey struct{ day, key, model string }
+
+var (
+	mu        sync.Mutex
+	dir       string
+	retention = 90 // 保留天数，<= 0 时不清理
+	pruned    string
+	records   = make(map[recordKey]*Record)
+	dirty     = make(map[string]bool)
+	saveC     = make(chan struct{}, 1)
+
+	// key 标签只使用哈希，与 /v1/costs 返回的 key 一致
+	requestsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chatgpt_adapter_requests_total",
+		Help: "Upstream requests by model and client key hash.",
+	}, []string{"model", "key"})
+	tokensCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chatgpt_adapter_tokens_total",
+		Help: "Tokens by model, client key hash and type (prompt, completion, cached).",
+	}, []string{"model", "key", "type"})
+	imagesCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chatgpt_adapter_images_total",
+		Help: "Generated images by model and client key hash.",
+	}, []string{"model", "key"})
+	costCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chatgpt_adapter_cost_total",
+		Help: "Cost computed from the pricing table by model and client key hash.",
+	}, []string{"model", "key"})
+)
+
+// 记录一次上游请求的用量，返回计算出的费用
+func Track(token, mod string, usage Usage) (cost float64) {
+	price, priced := PriceOf(mod)
+	if priced {
+		cost = price.Cost(usage.Prompt, usage.Output, usage.Cached) + float64(usage.Images)*price.Image
+	}
+
+	key := KeyOf(token)
+	now := time.Now()
+	day := now.Format(dayLayout)
+
+	mu.Lock()
+	// 每天第一次记录时清理过期的账本
+	expired := pruned != day
+	pruned = day
+	rk := recordKey{day, key, mod}
+	record, ok := records[rk]
+	if !ok {
+		record = &Record{Day: day, Key: key, Model: mod}
+		records[rk] = record
+	}
+	record.Requests++
+	record.Prompt += usage.Prompt
+	record.Output += usage.Output
+	record.Cached += usage.Cached
+	record.Images += usage.Images
+	record.Priced = priced
+	record.Cost += cost
+	if usage.Estimated {
+		record.Estimated++
+	}
+	dirty[day] = true
+	mu.Unlock()
+	persist()
+	if expired {
+		prune(now)
+	}
+
+	requestsCounter.WithLabelValues(mod, key).Inc()
+	tokensCounter.WithLabelValues(mod, key, "prompt").Add(float64(usage.Prompt))
+	tokensCounter.WithLabelValues(mod, key, "completion").Add(float64(usage.Output))
+	tokensCounter.WithLabelValues(mod, key, "cached").Add(float64(usage.Cached))
+	if usage.Images > 0 {
+		imagesCounter.WithLabelValues(mod, key).Add(float64(usage.Images))
+	}
+	costCounter.WithLabelValues(mod, key).Add(cost)
+
+	logger.Infof("cost: key=%s model=%s prompt=%d completion=%d cached=%d images=%d estimated=%v priced=%v cost=%.6f",
+		key, mod, usage.Prompt, usage.Output, usage.Cached, usage.Images, usage.Estimated, priced, cost)
+	return
+}
+
+// 查询条件为空时不过滤；from / to 为闭区间的日期
+type Query struct {
+	Key   string
+	Model string
+	From  string
+	To    string
+}
+
+func Find(query Query) (slice []Record) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, record := range records {
+		if query.Key != "" && record.Key != query.Key {
+			continue
+		}
+		if query.Model != "" && !match(query.Model, record.Model) {
+			continue
+		}
+		if query.From != "" && record.Day < query.From {
+			continue
+		}
+		if query.To != "" && record.Day > query.To {
+			continue
+		}
+		slice = append(slice, *record)
+	}
+
+	sort.Slice(slice, func(i, j int) bool {
+		if slice[i].Day != slice[j].Day {
+			return slice[i].Day > slice[j].Day
+		}
+		if slice[i].Cost != slice[j].Cost {
+			return slice[i].Cost > slice[j].Cost
+		}
+		return slice[i].Model < slice[j].Model
+	})
+	return
+}
+
+// 客户端 key 只保存哈希
+func KeyOf(token string) string {
+	if token == "" {
+		return "anonymous"
+	}
+	return common.CalcHex(token)[:16]
+}
+
+func load() {
+	if dir == "" {
+		return
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	for _, file := range files {
+		data, e := os.ReadFile(file)
+		if e != nil {
+			logger.Warnf("load costs %s failed: %v", file, e)
+			continue
+		}
+
+		var slice []*Record
+		if e = json.Unmarshal(data, &slice); e != nil {
+			logger.Warnf("load costs %s failed: %v", file, e)
+			continue
+		}
+		for _, record := range slice {
+			records[recordKey{record.Day, record.Key, record.Model}] = record
+		}
+	}
+	logger.Infof("loaded %d cost records from %s", len(records), dir)
+}
+
+// 删除超过保留天数的记录及其文件
+func prune(now time.Time) {
+	if retention <= 0 {
+		return
+	}
+
+	cutoff := now.AddDate(0, 0, -retention).Format(dayLayout)
+	mu.Lock()
+	for rk := range records {
+		if rk.day < cutoff {
+			delete(records, rk)
+			delete(dirty, rk.day)
+		}
+	}
+	mu.Unlock()
+
+	if dir == "" {
+		return
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	for _, file := range files {
+		day := strings.TrimSuffix(filepath.Base(file), ".json")
+		if _, e := time.Parse(dayLayout, day); e != nil || day >= cutoff {
+			continue
+		}
+		if e := os.Remove(file); e != nil {
+			logger.Warnf("remove costs %s failed: %v", file, e)
+		}
+	}
+}
+
+// 通知后台协程保存，多次变更合并为一次写入
+func persist() {
+	if dir == "" {
+		return
+	}
+	select {
+	case saveC <- struct{}{}:
+	default:
+	}
+}
+
+func saver() {
+	for range saveC {
+		if err := save(); err != nil {
+			logger.Warnf("save costs failed: %v", err)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func save() error {
+	mu.Lock()
+	days := make(map[string][]Record)
+	for day := range dirty {
+		days[day] = make([]Record, 0)
+	}
+	for rk, record := range records {
+		if _, ok := days[rk.day]; ok {
+			days[rk.day] = append(days[rk.day], *record)
+		}
+	}
+	dirty = make(map[string]bool)
+	mu.Unlock()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for day, slice := range days {
+		data, err := json.Marshal(slice)
+		if err != nil {
+			return err
+		}
+
+		file := filepath.Join(dir, day+".json")
+		if err = os.WriteFile(file+".tmp", data, 0600); err != nil {
+			return err
+		}
+		if err = os.Rename(file+".tmp", file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package pricing
+
+import (
+	"path"
+	"time"
+
+	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/core/logger"
+	"github.com/iocgo/sdk/env"
+)
+
+// 价格表，单价按每 1K token 计，图片按张计：
+//
+//	pricing:
+//	  dir: data/costs               # 账本持久化目录，每天一个 <day>.json；默认 data/costs
+//	  retention-days: 90            # 账本保留天数，<= 0 时不清理；默认 90
+//	  models:
+//	    - model: deepseek-chat      # 适配器模型 id，支持通配符
+//	      aliases: [ "deepseek-*" ] # 别名，同样支持通配符
+//	      input: 0.00027
+//	      output: 0.0011
+//	      cached: 0.00007           # 命中缓存的输入单价，未配置时按 input 计
+//	    - model: dall-e-3
+//	      image: 0.04               # v1/images/generations 每张图片的价格
+type Price struct {
+	Model   string   `mapstructure:"model"`
+	Aliases []string `mapstructure:"aliases"`
+	Input   float64  `mapstructure:"input"`
+	Output  float64  `mapstructure:"output"`
+	Cached  float64  `mapstructure:"cached"`
+	Image   float64  `mapstructure:"image"`
+}
+
+var prices []Price
+
+func init() {
+	inited.AddExited(func(*env.Environment) {
+		if dir != "" {
+			if err := save(); err != nil {
+				logger.Warnf("save costs failed: %v", err)
+			}
+		}
+	})
+	inited.AddInitialized(func(env *env.Environment) {
+		if err := env.UnmarshalKey("pricing.models", &prices); err != nil {
+			logger.Fatal(err)
+		}
+
+		dir = "data/costs"
+		if env.IsSet("pricing.dir") {
+			dir = env.GetString("pricing.dir")
+		}
+		if env.IsSet("pricing.retention-days") {
+			retention = env.GetInt("pricing.retention-days")
+		}
+		load()
+		prune(time.Now())
+		go saver()
+	})
+}
+
+// 按配置顺序匹配模型 id 与别名
+func PriceOf(mod string) (Price, bool) {
+	for _, price := range prices {
+		if match(price.Model, mod) {
+			return price, true
+		}
+		for _, alias := range price.Aliases {
+			if match(alias, mod) {
+				return price, true
+			}
+		}
+	}
+	return Price{}, false
+}
+
+func match(pattern, mod string) bool {
+	if pattern == mod {
+		return true
+	}
+	ok, _ := path.Match(pattern, mod)
+	return ok
+}
+
+// 按用量计算费用，推理 token 已包含在 completion_tokens 中
+func (price Price) Cost(prompt, completion, cached int) float64 {
+	cachedPrice := price.Cached
+	if cachedPrice == 0 {
+		cachedPrice = price.Input
+	}
+	return float64(prompt-cached)/1000*price.Input +
+		float64(cached)/1000*cachedPrice +
+		float64(completion)/1000*price.Output
+}
@@ -0,0 +1,141 @@
+package pricing
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPriceCost(t *testing.T) {
+	tests := []struct {
+		name       string
+		price      Price
+		prompt     int
+		completion int
+		cached     int
+		want       float64
+	}{
+		{"zero usage", Price{Input: 0.001, Output: 0.002}, 0, 0, 0, 0},
+		{"input and output", Price{Input: 0.001, Output: 0.002}, 1000, 500, 0, 0.002},
+		{"cached price", Price{Input: 0.001, Output: 0.002, Cached: 0.0001}, 1000, 0, 600, 0.00046},
+		{"cached falls back to input", Price{Input: 0.001, Output: 0.002}, 1000, 0, 600, 0.001},
+		{"deepseek-chat", Price{Input: 0.00027, Output: 0.0011, Cached: 0.00007}, 12000, 3000, 8000, 0.00494},
+		{"unpriced", Price{}, 1000, 1000, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.price.Cost(tt.prompt, tt.completion, tt.cached); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Cost() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPriceOf(t *testing.T) {
+	defer func(saved []Price) { prices = saved }(prices)
+	prices = []Price{
+		{Model: "deepseek-chat", Aliases: []string{"deepseek-*"}, Input: 1},
+		{Model: "claude-3-5-*", Input: 2},
+		{Model: "dall-e-3", Image: 0.04},
+	}
+
+	tests := []struct {
+		mod    string
+		input  float64
+		image  float64
+		priced bool
+	}{
+		{"deepseek-chat", 1, 0, true},
+		{"deepseek-reasoner", 1, 0, true},
+		{"claude-3-5-sonnet-20241022", 2, 0, true},
+		{"dall-e-3", 0, 0.04, true},
+		{"gpt-4o", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mod, func(t *testing.T) {
+			price, priced := PriceOf(tt.mod)
+			if priced != tt.priced || price.Input != tt.input || price.Image != tt.image {
+				t.Errorf("PriceOf(%q) = %+v, %v", tt.mod, price, priced)
+			}
+		})
+	}
+}
+
+func TestKeyOf(t *testing.T) {
+	if got := KeyOf(""); got != "anonymous" {
+		t.Errorf("KeyOf(\"\") = %q", got)
+	}
+
+	key := KeyOf("sk-secret-token")
+	if len(key) != 16 || key != KeyOf("sk-secret-token") || key == KeyOf("sk-other-token") {
+		t.Errorf("KeyOf() = %q is not a stable 16 char hash", key)
+	}
+}
+
+func TestTrack(t *testing.T) {
+	defer func(saved []Price, savedDir string) { prices, dir = saved, savedDir }(prices, dir)
+	prices, dir = []Price{{Model: "deepseek-chat", Input: 0.001, Output: 0.002}}, ""
+
+	Track("sk-track-secret", "deepseek-chat", Usage{Prompt: 1000, Output: 500})
+	Track("sk-track-secret", "deepseek-chat", Usage{Prompt: 1000, Estimated: true})
+
+	slice := Find(Query{Key: KeyOf("sk-track-secret")})
+	if len(slice) != 1 {
+		t.Fatalf("Find() = %+v, want one record", slice)
+	}
+	record := slice[0]
+	if record.Key != KeyOf("sk-track-secret") || record.Requests != 2 || record.Prompt != 2000 || record.Estimated != 1 || !record.Priced {
+		t.Errorf("record = %+v", record)
+	}
+	if math.Abs(record.Cost-0.003) > 1e-9 {
+		t.Errorf("cost = %v, want 0.003", record.Cost)
+	}
+
+	data, _ := json.Marshal(record)
+	if strings.Contains(string(data), "sk-") || strings.Contains(string(data), "cret") {
+		t.Errorf("record leaks the client key: %s", data)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	defer func(savedDir string, savedRetention int) { dir, retention = savedDir, savedRetention }(dir, retention)
+	dir, retention = t.TempDir(), 30
+
+	now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.Local)
+	days := []string{"2026-02-28", "2026-03-01", "2026-03-31"}
+	mu.Lock()
+	for _, day := range days {
+		records[recordKey{day, "prune", "gpt-4o"}] = &Record{Day: day, Key: "prune", Model: "gpt-4o"}
+	}
+	mu.Unlock()
+	for _, name := range append(days, "notes") {
+		if err := os.WriteFile(filepath.Join(dir, name+".json"), []byte("[]"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prune(now)
+
+	var kept []string
+	for _, record := range Find(Query{Key: "prune"}) {
+		kept = append(kept, record.Day)
+	}
+	if !slices.Equal(kept, []string{"2026-03-31", "2026-03-01"}) {
+		t.Errorf("kept records = %v", kept)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	for i := range files {
+		files[i] = filepath.Base(files[i])
+	}
+	if !slices.Equal(files, []string{"2026-03-01.json", "2026-03-31.json", "notes.json"}) {
+		t.Errorf("kept files = %v", files)
+	}
+}
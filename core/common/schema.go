@@ -0,0 +1,359 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// 从模型输出中提取 JSON 文本：兼容 ```json 代码块以及前后夹杂的说明文字
+func ExtractJSON(content string) (string, bool) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return "", false
+	}
+
+	if json.Valid([]byte(content)) {
+		return content, true
+	}
+
+	if idx := strings.Index(content, "```"); idx >= 0 {
+		block := content[idx+3:]
+		if end := strings.Index(block, "```"); end >= 0 {
+			block = block[:end]
+		}
+		if nl := strings.Index(block, "\n"); nl >= 0 && !strings.ContainsAny(block[:nl], "{[") {
+			block = block[nl+1:]
+		}
+		block = strings.TrimSpace(block)
+		if json.Valid([]byte(block)) {
+			return block, true
+		}
+	}
+
+	for _, pair := range [][2]string{{"{", "}"}, {"[", "]"}} {
+		start := strings.Index(content, pair[0])
+		end := strings.LastIndex(content, pair[1])
+		if start < 0 || end <= start {
+			continue
+		}
+		block := content[start : end+1]
+		if json.Valid([]byte(block)) {
+			return block, true
+		}
+	}
+	return "", false
+}
+
+// 按 JSON Schema 校验数据，返回所有不满足约束的描述；为空表示校验通过。
+// 只实现了常用的子集：type、enum、const、properties、required、additionalProperties、
+// items、min/maxItems、min/maxLength、pattern、minimum/maximum、anyOf/oneOf/allOf 以及本地 $ref
+func ValidateSchema(schema map[string]interface{}, value interface{}) []string {
+	v := &validator{root: schema}
+	v.validate("$", schema, value)
+	return v.errors
+}
+
+type validator struct {
+	root   map[string]interface{}
+	errors []string
+	depth  int
+}
+
+func (v *validator) errorf(path, format string, args ...interface{}) {
+	v.errors = append(v.errors, path+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *validator) validate(path string, schema map[string]interface{}, value interface{}) {
+	if schema == nil {
+		return
+	}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		v.depth++
+		defer func() { v.depth-- }()
+		if v.depth > 32 {
+			v.errorf(path, "schema $ref nesting too deep")
+			return
+		}
+		resolved := v.resolve(ref)
+		if resolved == nil {
+			v.errorf(path, "unresolvable $ref '%s'", ref)
+			return
+		}
+		v.validate(path, resolved, value)
+		return
+	}
+
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			if isType(t, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.errorf(path, "expected %s, got %s", strings.Join(types, " or "), typeOf(value))
+			return
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		matched := false
+		for _, item := range enum {
+			if equal(item, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			bytes, _ := json.Marshal(enum)
+			v.errorf(path, "value must be one of %s", bytes)
+		}
+	}
+
+	if c, ok := schema["const"]; ok && !equal(c, value) {
+		bytes, _ := json.Marshal(c)
+		v.errorf(path, "value must be %s", bytes)
+	}
+
+	v.combinators(path, schema, value)
+
+	switch val := value.(type) {
+	case map[string]interface{}:
+		v.object(path, schema, val)
+	case []interface{}:
+		v.array(path, schema, val)
+	case string:
+		v.string(path, schema, val)
+	case float64:
+		v.number(path, schema, val)
+	}
+}
+
+func (v *validator) combinators(path string, schema map[string]interface{}, value interface{}) {
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, item := range all {
+			if sub, ok := item.(map[string]interface{}); ok {
+				v.validate(path, sub, value)
+			}
+		}
+	}
+
+	count := func(items []interface{}) (matched int) {
+		for _, item := range items {
+			sub, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			child := &validator{root: v.root, depth: v.depth}
+			child.validate(path, sub, value)
+			if len(child.errors) == 0 {
+				matched++
+			}
+		}
+		return
+	}
+
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok && count(anyOf) == 0 {
+		v.errorf(path, "value does not match any of the allowed schemas")
+	}
+
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		if matched := count(oneOf); matched != 1 {
+			v.errorf(path, "value must match exactly one schema, matched %d", matched)
+		}
+	}
+}
+
+func (v *validator) object(path string, schema map[string]interface{}, value map[string]interface{}) {
+	properties, _ := schema["properties"].(map[string]interface{})
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, item := range required {
+			key, _ := item.(string)
+			if _, exists := value[key]; key != "" && !exists {
+				v.errorf(path, "missing required property '%s'", key)
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		child := path + "." + key
+		if sub, ok := properties[key].(map[string]interface{}); ok {
+			v.validate(child, sub, value[key])
+			continue
+		}
+
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.errorf(path, "additional property '%s' is not allowed", key)
+			}
+		case map[string]interface{}:
+			v.validate(child, additional, value[key])
+		}
+	}
+}
+
+func (v *validator) array(path string, schema map[string]interface{}, value []interface{}) {
+	if min, ok := toFloat(schema["minItems"]); ok && float64(len(value)) < min {
+		v.errorf(path, "expected at least %v items, got %d", min, len(value))
+	}
+	if max, ok := toFloat(schema["maxItems"]); ok && float64(len(value)) > max {
+		v.errorf(path, "expected at most %v items, got %d", max, len(value))
+	}
+
+	items, ok := schema["items"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for i, item := range value {
+		v.validate(fmt.Sprintf("%s[%d]", path, i), items, item)
+	}
+}
+
+func (v *validator) string(path string, schema map[string]interface{}, value string) {
+	length := float64(utf8.RuneCountInString(value))
+	if min, ok := toFloat(schema["minLength"]); ok && length < min {
+		v.errorf(path, "string shorter than %v characters", min)
+	}
+	if max, ok := toFloat(schema["maxLength"]); ok && length > max {
+		v.errorf(path, "string longer than %v characters", max)
+	}
+
+	if pattern, ok := schema["pattern"].(string); ok {
+		compile, err := regexp.Compile(pattern)
+		if err == nil && !compile.MatchString(value) {
+			v.errorf(path, "string does not match pattern '%s'", pattern)
+		}
+	}
+}
+
+func (v *validator) number(path string, schema map[string]interface{}, value float64) {
+	if min, ok := toFloat(schema["minimum"]); ok && value < min {
+		v.errorf(path, "value must be >= %v", min)
+	}
+	if max, ok := toFloat(schema["maximum"]); ok && value > max {
+		v.errorf(path, "value must be <= %v", max)
+	}
+	if min, ok := toFloat(schema["exclusiveMinimum"]); ok && value <= min {
+		v.errorf(path, "value must be > %v", min)
+	}
+	if max, ok := toFloat(schema["exclusiveMaximum"]); ok && value >= max {
+		v.errorf(path, "value must be < %v", max)
+	}
+}
+
+// 仅支持文档内引用，如 #/$defs/xxx、#/definitions/xxx
+func (v *validator) resolve(ref string) map[string]interface{} {
+	if ref == "#" {
+		return v.root
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		return nil
+	}
+
+	var node interface{} = v.root
+	for _, key := range strings.Split(ref[2:], "/") {
+		key = strings.ReplaceAll(strings.ReplaceAll(key, "~1", "/"), "~0", "~")
+		obj, ok := node.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		node = obj[key]
+	}
+
+	resolved, _ := node.(map[string]interface{})
+	return resolved
+}
+
+func schemaTypes(value interface{}) []string {
+	switch t := value.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		types := make([]string, 0, len(t))
+		for _, item := range t {
+			if str, ok := item.(string); ok {
+				types = append(types, str)
+			}
+		}
+		return types
+	default:
+		return nil
+	}
+}
+
+func isType(t string, value interface{}) bool {
+	switch t {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		num, ok := value.(float64)
+		return ok && num == math.Trunc(num)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	default:
+		return true
+	}
+}
+
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func equal(a, b interface{}) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return string(x) == string(y)
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,127 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestExtractJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		ok      bool
+	}{
+		{"plain", `{"a":1}`, `{"a":1}`, true},
+		{"code fence", "```json\n{\"a\":1}\n```", `{"a":1}`, true},
+		{"code fence without language", "```\n[1,2]\n```", `[1,2]`, true},
+		{"surrounding text", `Sure! Here it is: {"a":{"b":2}} Hope this helps.`, `{"a":{"b":2}}`, true},
+		{"array in text", `result: [1, 2, 3].`, `[1, 2, 3]`, true},
+		{"empty", "  ", "", false},
+		{"not json", "hello {world}", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ExtractJSON(tt.content)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("ExtractJSON() = %q, %v, want %q, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	schema := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(`{
+		"type": "object",
+		"properties": {
+			"name":   {"type": "string", "minLength": 1, "maxLength": 8},
+			"age":    {"type": "integer", "minimum": 0, "exclusiveMaximum": 150},
+			"level":  {"enum": ["low", "high"]},
+			"email":  {"type": ["string", "null"], "pattern": "^[^@]+@[^@]+$"},
+			"tags":   {"type": "array", "items": {"type": "string"}, "minItems": 1, "maxItems": 2},
+			"owner":  {"$ref": "#/$defs/person"},
+			"status": {"const": "ok"},
+			"id":     {"oneOf": [{"type": "integer"}, {"type": "string", "pattern": "^[0-9]+$"}]}
+		},
+		"required": ["name", "age"],
+		"additionalProperties": false,
+		"$defs": {
+			"person": {
+				"type": "object",
+				"properties": {
+					"name":     {"type": "string"},
+					"contacts": {"type": "array", "items": {"type": "object", "required": ["kind"], "properties": {"kind": {"enum": ["mail", "phone"]}}}}
+				},
+				"required": ["name"]
+			}
+		}
+	}`), &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{"valid", `{"name":"li","age":3,"level":"low","email":null,"tags":["a"],"owner":{"name":"wang","contacts":[{"kind":"mail"}]},"status":"ok","id":7}`, nil},
+		{"wrong root type", `[]`, []string{"$: expected object, got array"}},
+		{"missing required", `{"name":"li"}`, []string{"$: missing required property 'age'"}},
+		{"integer", `{"name":"li","age":3.5}`, []string{"$.age: expected integer, got number"}},
+		{"range", `{"name":"li","age":150}`, []string{"$.age: value must be < 150"}},
+		{"enum", `{"name":"li","age":3,"level":"mid"}`, []string{`$.level: value must be one of ["low","high"]`}},
+		{"string length", `{"name":"","age":3}`, []string{"$.name: string shorter than 1 characters"}},
+		{"pattern", `{"name":"li","age":3,"email":"nope"}`, []string{"$.email: string does not match pattern '^[^@]+@[^@]+$'"}},
+		{"additional property", `{"name":"li","age":3,"extra":1}`, []string{"$: additional property 'extra' is not allowed"}},
+		{"array items", `{"name":"li","age":3,"tags":["a",1]}`, []string{"$.tags[1]: expected string, got number"}},
+		{"array size", `{"name":"li","age":3,"tags":[]}`, []string{"$.tags: expected at least 1 items, got 0"}},
+		{"nested ref", `{"name":"li","age":3,"owner":{}}`, []string{"$.owner: missing required property 'name'"}},
+		{"nested array object", `{"name":"li","age":3,"owner":{"name":"w","contacts":[{"kind":"fax"},{}]}}`, []string{
+			`$.owner.contacts[0].kind: value must be one of ["mail","phone"]`,
+			"$.owner.contacts[1]: missing required property 'kind'",
+		}},
+		{"const", `{"name":"li","age":3,"status":"bad"}`, []string{`$.status: value must be "ok"`}},
+		{"one of", `{"name":"li","age":3,"id":"x"}`, []string{"$.id: value must match exactly one schema, matched 0"}},
+		{"multiple problems", `{"age":-1}`, []string{"$: missing required property 'name'", "$.age: value must be >= 0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value interface{}
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatal(err)
+			}
+			got := ValidateSchema(schema, value)
+			if len(got) != len(tt.want) {
+				t.Fatalf("ValidateSchema() = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("ValidateSchema()[%d] = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateSchemaRef(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema map[string]interface{}
+		want   string
+	}{
+		{"unresolvable", map[string]interface{}{"$ref": "#/$defs/missing"}, "$: unresolvable $ref '#/$defs/missing'"},
+		{"remote", map[string]interface{}{"$ref": "http://example.com/schema.json"}, "$: unresolvable $ref 'http://example.com/schema.json'"},
+		{"recursive", map[string]interface{}{"$ref": "#"}, "$: schema $ref nesting too deep"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidateSchema(tt.schema, 1.0); len(got) != 1 || got[0] != tt.want {
+				t.Errorf("ValidateSchema() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
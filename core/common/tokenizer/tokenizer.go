@@ -0,0 +1,175 @@
+package tokenizer
+
+import (
+	"math"
+	"path"
+	"strings"
+	"sync"
+	"unicode"
+
+	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/core/logger"
+	"github.com/iocgo/sdk/env"
+	tiktoken "github.com/tiktoken-go/tokenizer"
+)
+
+// 分词器配置，未配置时按模型系列选择：
+//
+//	tokenizer:
+//	  default: cl100k_base      # 未识别模型使用的分词器
+//	  models:
+//	    - model: "bing*"        # 支持通配符，优先于内置规则
+//	      tokenizer: o200k_base # cl100k_base / o200k_base / approx / approx-claude / approx-deepseek
+const (
+	Cl100kBase     = "cl100k_base"
+	O200kBase      = "o200k_base"
+	Approx         = "approx"
+	ApproxClaude   = "approx-claude"
+	ApproxDeepseek = "approx-deepseek"
+)
+
+type Tokenizer interface {
+	Name() string
+	Count(content string) int
+}
+
+type modelObj struct {
+	Model     string `mapstructure:"model"`
+	Tokenizer string `mapstructure:"tokenizer"`
+}
+
+// 内置规则，按模型名（去掉 `xxx/` 前缀）的前缀匹配
+var families = []struct {
+	prefixes []string
+	name     string
+}{
+	{[]string{"gpt-4o", "gpt4o", "chatgpt-4o", "gpt-4.1", "gpt-5", "o1", "o3", "o4"}, O200kBase},
+	{[]string{"gpt-4", "gpt4", "gpt-3.5", "gpt-35", "text-embedding"}, Cl100kBase},
+	{[]string{"claude"}, ApproxClaude},
+	{[]string{"deepseek"}, ApproxDeepseek},
+}
+
+var (
+	mu       sync.Mutex
+	registry = map[string]Tokenizer{
+		Approx:         &approx{Approx, 4, 1},
+		ApproxClaude:   &approx{ApproxClaude, 3.5, 1.2},
+		ApproxDeepseek: &approx{ApproxDeepseek, 3.3, 0.6},
+	}
+
+	models      []modelObj
+	defaultName = Cl100kBase
+)
+
+func init() {
+	inited.AddInitialized(func(env *env.Environment) {
+		if err := env.UnmarshalKey("tokenizer.models", &models); err != nil {
+			logger.Fatal(err)
+		}
+		if name := env.GetString("tokenizer.default"); name != "" {
+			defaultName = name
+		}
+
+		for _, name := range append([]string{defaultName}, names()...) {
+			if _, err := get(name); err != nil {
+				logger.Fatalf("tokenizer '%s': %v", name, err)
+			}
+		}
+	})
+}
+
+func names() (slice []string) {
+	for _, obj := range models {
+		slice = append(slice, obj.Tokenizer)
+	}
+	return
+}
+
+// 编码器只在首次使用时加载，之后复用
+func get(name string) (Tokenizer, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if t, ok := registry[name]; ok {
+		return t, nil
+	}
+
+	codec, err := tiktoken.Get(tiktoken.Encoding(name))
+	if err != nil {
+		return nil, err
+	}
+	t := &bpe{name, codec}
+	registry[name] = t
+	return t, nil
+}
+
+func NameOf(mod string) string {
+	for _, obj := range models {
+		if ok, _ := path.Match(obj.Model, mod); ok || obj.Model == mod {
+			return obj.Tokenizer
+		}
+	}
+
+	mod = strings.ToLower(mod)
+	if pos := strings.LastIndex(mod, "/"); pos >= 0 {
+		mod = mod[pos+1:]
+	}
+	for _, family := range families {
+		for _, prefix := range family.prefixes {
+			if strings.HasPrefix(mod, prefix) {
+				return family.name
+			}
+		}
+	}
+	return defaultName
+}
+
+func For(mod string) Tokenizer {
+	t, err := get(NameOf(mod))
+	if err != nil {
+		logger.Error(err)
+		t, _ = get(Approx)
+	}
+	return t
+}
+
+func Count(mod, content string) int {
+	if content == "" {
+		return 0
+	}
+	return For(mod).Count(content)
+}
+
+type bpe struct {
+	name  string
+	codec tiktoken.Codec
+}
+
+func (t *bpe) Name() string { return t.name }
+func (t *bpe) Count(content string) int {
+	count, err := t.codec.Count(content)
+	if err != nil {
+		logger.Error(err)
+		return 0
+	}
+	return count
+}
+
+// 没有公开词表的模型按字符估算：非 CJK 字符每 chars 个计 1，CJK 字符每个计 cjk
+type approx struct {
+	name  string
+	chars float64
+	cjk   float64
+}
+
+func (t *approx) Name() string { return t.name }
+func (t *approx) Count(content string) int {
+	var other, cjk float64
+	for _, r := range content {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return int(math.Ceil(other/t.chars + cjk*t.cjk))
+}
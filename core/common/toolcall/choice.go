@@ -0,0 +1,51 @@
+package toolcall
+
+import (
+	"chatgpt-adapter/core/gin/model"
+)
+
+const (
+	ChoiceAuto     = "auto"
+	ChoiceNone     = "none"
+	ChoiceRequired = "required"
+	ChoiceFunction = "function"
+)
+
+// 解析 tool_choice，返回模式以及强制调用的函数名
+//
+//	"none" / "auto" / "required"
+//	{"type": "function", "function": {"name": "xxx"}}
+func ParseToolChoice(toolChoice interface{}) (mode, name string) {
+	switch choice := toolChoice.(type) {
+	case string:
+		switch choice {
+		case ChoiceNone, ChoiceRequired:
+			return choice, ""
+		}
+	case map[string]interface{}:
+		keyv := model.Keyv[interface{}](choice)
+		if !keyv.Is("type", "function") {
+			break
+		}
+		if name = keyv.GetKeyv("function").GetString("name"); name != "" {
+			return ChoiceFunction, name
+		}
+	}
+	return ChoiceAuto, ""
+}
+
+// 只保留强制调用的工具
+func filterTools(tools []model.Keyv[interface{}], name string) (slice []model.Keyv[interface{}]) {
+	for _, t := range tools {
+		if t.GetKeyv("function").GetString("name") == name {
+			slice = append(slice, t)
+		}
+	}
+	return
+}
+
+// 工具是否没有任何参数
+func withoutArgs(tool model.Keyv[interface{}]) bool {
+	properties := tool.GetKeyv("function").GetKeyv("parameters").GetKeyv("properties")
+	return len(properties) == 0
+}
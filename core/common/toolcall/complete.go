@@ -27,10 +27,16 @@ var (
 )
 
 func NeedExec(ctx *gin.Context) bool {
-	var tool = "-1"
+	mode, _ := ParseToolChoice(common.GetGinCompletion(ctx).ToolChoice)
+	if mode == ChoiceNone {
+		return false
+	}
+
+	var tool, loop = "-1", false
 	{
+		// required 或指定函数时必须调用工具，未开启模拟时对本次请求开启
 		t := common.GetGinToolValue(ctx)
-		if !t.Is("enabled", true) {
+		if !t.Is("enabled", true) && mode != ChoiceRequired && mode != ChoiceFunction {
 			return false
 		}
 
@@ -38,6 +44,7 @@ func NeedExec(ctx *gin.Context) bool {
 		if tool == "-1" && t.Is("tasks", true) {
 			tool = "tasks"
 		}
+		loop = t.Is("loop", true)
 	}
 
 	completion := common.GetGinCompletion(ctx)
@@ -50,8 +57,9 @@ func NeedExec(ctx *gin.Context) bool {
 		return false
 	}
 
+	// 服务端执行工具时，拿到工具结果后仍需判断是否继续调用
 	role := completion.Messages[messageL-1]["role"]
-	return (role != "function" && role != "tool") || tool != "-1"
+	return (role != "function" && role != "tool") || tool != "-1" || loop
 }
 
 func Cancel(str string) bool {
@@ -87,6 +95,15 @@ func Cancel(str string) bool {
 	return false
 }
 
+// 模型未给出有效调用时使用的默认工具；强制调用指定函数时只能是该函数，否则返回 -1
+func defaultTool(ctx *gin.Context, completion model.Completion) string {
+	value := Query(common.GetGinToolValue(ctx).GetString("id"), completion.Tools)
+	if mode, forced := ParseToolChoice(completion.ToolChoice); mode == ChoiceFunction && value != forced {
+		return "-1"
+	}
+	return value
+}
+
 // 工具名是否存在工具集中，"-1" 不存在，否则返回具体名字
 func Query(key string, tools []model.Keyv[interface{}]) (value string) {
 	value = key
@@ -131,7 +148,7 @@ func ToolChoice(ctx *gin.Context, completion model.Completion, callback func(mes
 		toolCache := hex(completion)
 		if completion.Messages, hasTasks = taskComplete(ctx, completion, callback); !hasTasks {
 			// 非-1值则为有默认选项
-			valueDef := Query(common.GetGinToolValue(ctx).GetString("id"), completion.Tools)
+			valueDef := defaultTool(ctx, completion)
 			if valueDef != "-1" {
 				return toolCallResponse(ctx, completion, valueDef, "{}", time.Now().Unix()), nil
 			}
@@ -161,32 +178,19 @@ func ToolChoice(ctx *gin.Context, completion model.Completion, callback func(mes
 		}
 	}
 
-	// toolChoice自推荐toolId处理
-	if completion.ToolChoice != "" && completion.ToolChoice != "auto" {
-		var (
-			keyv       model.Keyv[interface{}]
-			toolChoice model.Keyv[interface{}]
-			ok         = false
-		)
-		toolChoice, ok = completion.ToolChoice.(map[string]interface{})
-		if !ok || !toolChoice.Is("type", "function") {
-			goto label
-		}
-
-		keyv = toolChoice.GetKeyv("function")
-		if !keyv.Has("name") {
-			goto label
+	// 强制调用指定工具：只向模型提供该工具
+	mode, forced := ParseToolChoice(completion.ToolChoice)
+	if mode == ChoiceFunction {
+		completion.Tools = filterTools(completion.Tools, forced)
+		if len(completion.Tools) == 0 {
+			return false, fmt.Errorf("tool_choice function '%s' is not found in tools", forced)
 		}
-
-		if toolId := toolIdWithTools(keyv.GetString("name"), completion.Tools); toolId != "-1" {
-			completion.Messages = append(completion.Messages, model.Keyv[interface{}]{
-				"role": "user", "content": "continue。 工具推荐： toolId = " + toolId,
-			})
+		if withoutArgs(completion.Tools[0]) {
+			return toolCallResponse(ctx, completion, forced, "{}", time.Now().Unix()), nil
 		}
-	label:
 	}
 
-	message, err := buildTemplate(ctx, completion, agent.ToolCall)
+	message, err := buildTemplate(ctx, completion, agent.Template(agent.NameToolCall, completion.Model))
 	if err != nil {
 		return false, err
 	}
@@ -196,18 +200,36 @@ func ToolChoice(ctx *gin.Context, completion model.Completion, callback func(mes
 		return false, err
 	}
 
-	previousTokens := response.CalcTokens(message)
-	ctx.Set(vars.GinCompletionUsage, response.CalcUsageTokens(content, previousTokens))
+	previousTokens := response.CalcTokens(completion.Model, message)
+	ctx.Set(vars.GinCompletionUsage, response.CalcUsageTokens(completion.Model, content, previousTokens))
 
-	// 解析参数
-	return parseToTC(ctx, content, completion), nil
+	// 解析参数，校验不通过时带上错误重新提问；required 及强制调用时必须产生工具调用
+	for retry := repairRetries(); ; retry-- {
+		exec, name, problems := parseToTC(ctx, content, completion)
+		if !exec && len(problems) == 0 && mode != ChoiceAuto {
+			name, problems = forced, []string{"a tool call is required, but none was produced"}
+		}
+		if len(problems) == 0 {
+			return exec, nil
+		}
+
+		if retry <= 0 {
+			return false, fmt.Errorf("tool '%s' arguments validation failed: %s", name, strings.Join(problems, "; "))
+		}
+
+		logger.Infof("repair tool '%s' arguments, remaining retries: %d", name, retry)
+		content, err = callback(repairMessage(message, content, name, problems))
+		if err != nil {
+			return false, err
+		}
+	}
 }
 
 // 拆解任务, 组装任务提示并返回上下文 (包含缓存已执行的任务逻辑)
 func taskComplete(ctx *gin.Context, completion model.Completion, callback func(message string) (string, error)) (messages []model.Keyv[interface{}], hasTasks bool) {
 	cacheManager := cache.ToolTasksCacheManager()
 	messages = completion.Messages
-	message, err := buildTemplate(ctx, completion, agent.ToolTasks)
+	message, err := buildTemplate(ctx, completion, agent.Template(agent.NameToolTasks, completion.Model))
 	if err != nil {
 		logger.Error(err)
 		return
@@ -364,47 +386,8 @@ func buildTemplate(ctx *gin.Context, completion model.Completion, template strin
 	}
 
 	value, _ := ctx.Get(exclude_task_contents)
-	str, err := newBuilder("tool").
-		Vars("toolDef", getToolId(ctx, completion.Tools)).
-		Vars("tools", completion.Tools).
-		Vars("pMessages", pMessages).
-		Vars("excludeTaskContents", value).
-		Vars("content", content).
-		Func("ToolId", func(str string) string {
-			return toolIdWithTools(str, completion.Tools)
-		}).
-		Func("Join", func(slice []interface{}, sep string) string {
-			if len(slice) == 0 {
-				return ""
-			}
-			var result []string
-			for _, v := range slice {
-				result = append(result, fmt.Sprintf("\"%v\"", v))
-			}
-			return strings.Join(result, sep)
-		}).
-		Func("Has", func(obj map[string]interface{}, key string) bool {
-			_, exists := obj[key]
-			return exists
-		}).
-		Func("Len", func(slice []interface{}) int {
-			return len(slice)
-		}).
-		Func("Enc", func(value interface{}) string {
-			return strings.ReplaceAll(fmt.Sprintf("%s", value), "\n", "\\n")
-		}).
-		Func("ToolDesc", func(value string) string {
-			for _, t := range completion.Tools {
-				fn := t.GetKeyv("function")
-				if !fn.Has("name") {
-					continue
-				}
-				if value == fn.GetString("name") {
-					return fn.GetString("description")
-				}
-			}
-			return ""
-		}).String(template)
+	str, err := newToolBuilder(completion.Tools, getToolId(ctx, completion.Tools), pMessages, value, content).
+		String(template)
 	if err != nil {
 		return
 	}
@@ -428,8 +411,10 @@ func buildTemplate(ctx *gin.Context, completion model.Completion, template strin
 // 工具参数解析
 //
 //	return:
-//	bool  > 是否执行了工具
-func parseToTC(ctx *gin.Context, content string, completion model.Completion) bool {
+//	bool     > 是否执行了工具
+//	string   > 参数校验失败的工具名
+//	[]string > 参数校验失败的原因，非空时未执行工具
+func parseToTC(ctx *gin.Context, content string, completion model.Completion) (bool, string, []string) {
 	j := ""
 	created := time.Now().Unix()
 	slice := strings.Split(content, "TOOL_RESPONSE")
@@ -444,15 +429,15 @@ func parseToTC(ctx *gin.Context, content string, completion model.Completion) bo
 	}
 
 	// 非-1值则为有默认选项
-	valueDef := Query(common.GetGinToolValue(ctx).GetString("id"), completion.Tools)
+	valueDef := defaultTool(ctx, completion)
 
 	// 没有解析出 JSON
 	if j == "" {
 		if valueDef != "-1" {
-			return toolCallResponse(ctx, completion, valueDef, "{}", created)
+			return toolCallResponse(ctx, completion, valueDef, "{}", created), "", nil
 		}
 		logger.Infof("completeTools response failed: \n%s", content)
-		return false
+		return false, "", nil
 	}
 
 	var fn model.Keyv[interface{}]
@@ -475,28 +460,28 @@ func parseToTC(ctx *gin.Context, content string, completion model.Completion) bo
 	// 没有匹配到工具
 	if name == "" {
 		if valueDef != "-1" {
-			return toolCallResponse(ctx, completion, valueDef, "{}", created)
+			return toolCallResponse(ctx, completion, valueDef, "{}", created), "", nil
 		}
 		logger.Infof("completeTools response failed: \n%s", content)
-		return false
+		return false, "", nil
 	}
 
-	// 避免AI重复选择相同的工具
-	if names, ok := common.GetGinValues[string](ctx, exclude_tool_names); ok {
+	// 避免AI重复选择相同的工具，强制调用时不做限制
+	names, ok := common.GetGinValues[string](ctx, exclude_tool_names)
+	if mode, _ := ParseToolChoice(completion.ToolChoice); ok && mode == ChoiceAuto {
 		if slices.Contains(names, name) {
-			return valueDef != "-1" && toolCallResponse(ctx, completion, valueDef, "{}", created)
+			return valueDef != "-1" && toolCallResponse(ctx, completion, valueDef, "{}", created), "", nil
 		}
 	}
 
-	// 解析参数
+	// 解析参数，先尝试确定性修复
 	var js model.Keyv[interface{}]
+	if repaired, ok := repairJSON(j); ok {
+		j = repaired
+	}
 	if err := json.Unmarshal([]byte(j), &js); err != nil {
 		logger.Error(err)
-		if valueDef != "-1" {
-			return toolCallResponse(ctx, completion, valueDef, "{}", created)
-		}
-		logger.Infof("completeTools response failed: \n%s", content)
-		return false
+		return false, name, []string{"the tool call is not valid JSON: " + err.Error()}
 	}
 
 	logger.Infof("completeTools response: \n%s", j)
@@ -514,8 +499,13 @@ func parseToTC(ctx *gin.Context, content string, completion model.Completion) bo
 		}
 	}
 
+	obj, problems := validateArgs(fn, obj)
+	if len(problems) > 0 {
+		return false, name, problems
+	}
+
 	bytes, _ := json.Marshal(obj)
-	return toolCallResponse(ctx, completion, name, string(bytes), created)
+	return toolCallResponse(ctx, completion, name, string(bytes), created), name, nil
 }
 
 // 解析任务
@@ -714,7 +704,7 @@ func nameWithToolsNotArgs(task model.Keyv[string], tools []model.Keyv[interface{
 
 func tasksIsEnabled(ctx *gin.Context) bool {
 	completion := common.GetGinCompletion(ctx)
-	if completion.ToolChoice != "" && completion.ToolChoice != "auto" {
+	if mode, _ := ParseToolChoice(completion.ToolChoice); mode != ChoiceAuto {
 		return false
 	}
 
@@ -0,0 +1,112 @@
+package toolcall
+
+import (
+	"path"
+	"strings"
+
+	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/core/common/vars"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/iocgo/sdk/env"
+)
+
+const (
+	ModeOn    = "on"
+	ModeOff   = "off"
+	ModeTasks = "tasks"
+)
+
+// 模型后缀，如 deepseek/v3+tool-tasks
+var suffixes = []struct{ suffix, mode string }{
+	{"+tool-tasks", ModeTasks},
+	{"+tool-off", ModeOff},
+	{"+tool", ModeOn},
+}
+
+type modeObj struct {
+	Model string `mapstructure:"model"`
+	Mode  string `mapstructure:"mode"`
+	Id    string `mapstructure:"id"`
+}
+
+var (
+	defaultMode = modeObj{Mode: ModeOff, Id: "-1"}
+	modeObjs    []modeObj
+)
+
+func init() {
+	inited.AddInitialized(func(env *env.Environment) {
+		if mode := normalizeMode(env.GetString("toolcall.mode")); mode != "" {
+			defaultMode.Mode = mode
+		}
+		if id := env.GetString("toolcall.id"); id != "" {
+			defaultMode.Id = id
+		}
+
+		err := env.UnmarshalKey("toolcall.models", &modeObjs)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		for i, obj := range modeObjs {
+			if obj.Mode != "" && normalizeMode(obj.Mode) == "" {
+				logger.Fatalf("unknown tool call mode: toolcall.models[%d].mode = %s", i, obj.Mode)
+			}
+		}
+	})
+}
+
+// 解析工具调用模拟的模式并写入 vars.GinTool，返回去掉后缀的模型名。
+// 优先级：模型后缀 > 请求头 X-Tool-Mode / X-Tool-Id > toolcall.models > toolcall.mode
+func ApplyMode(ctx *gin.Context, mod string) string {
+	mode, id, from := defaultMode.Mode, defaultMode.Id, "default"
+	for _, obj := range modeObjs {
+		if matched, _ := path.Match(obj.Model, mod); !matched && obj.Model != mod {
+			continue
+		}
+		if obj.Mode != "" {
+			mode, from = normalizeMode(obj.Mode), "config"
+		}
+		if obj.Id != "" {
+			id, from = obj.Id, "config"
+		}
+		break
+	}
+
+	if value := normalizeMode(ctx.GetHeader("X-Tool-Mode")); value != "" {
+		mode, from = value, "header"
+	}
+	if value := ctx.GetHeader("X-Tool-Id"); value != "" {
+		id, from = value, "header"
+	}
+
+	for _, s := range suffixes {
+		if strings.HasSuffix(mod, s.suffix) {
+			mod = strings.TrimSuffix(mod, s.suffix)
+			mode, from = s.mode, "suffix"
+			break
+		}
+	}
+
+	ctx.Set(vars.GinTool, model.Keyv[interface{}]{
+		"id":      id,
+		"enabled": mode != ModeOff,
+		"tasks":   mode == ModeTasks,
+	})
+	logger.Infof("tool call mode: %s, id: %s, from: %s", mode, id, from)
+	return mod
+}
+
+func normalizeMode(mode string) string {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "on", "true", "enabled":
+		return ModeOn
+	case "off", "false", "disabled":
+		return ModeOff
+	case "tasks":
+		return ModeTasks
+	default:
+		return ""
+	}
+}
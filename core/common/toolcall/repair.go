@@ -0,0 +1,236 @@
+package toolcall
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/logger"
+	"github.com/iocgo/sdk/env"
+)
+
+var (
+	trailingCommaRegexp = regexp.MustCompile(`,\s*([}\]])`)
+	unquotedKeyRegexp   = regexp.MustCompile(`([{,]\s*)([A-Za-z_$][A-Za-z0-9_$-]*)\s*:`)
+	pyLiteralRegexp     = regexp.MustCompile(`([:\[,]\s*)(True|False|None)\b`)
+)
+
+// 参数校验失败时最多重新提问的次数，toolcall.repair-retries 默认 2
+func repairRetries() int {
+	if !env.Env.IsSet("toolcall.repair-retries") {
+		return 2
+	}
+	return env.Env.GetInt("toolcall.repair-retries")
+}
+
+// 确定性修复常见的 JSON 书写错误：尾逗号、单引号、未加引号的键、python 字面量、未闭合的括号
+func repairJSON(str string) (string, bool) {
+	if json.Valid([]byte(str)) {
+		return str, true
+	}
+
+	fixes := []func(string) string{
+		func(s string) string { return trailingCommaRegexp.ReplaceAllString(s, "$1") },
+		func(s string) string {
+			if strings.Contains(s, `"`) {
+				return s
+			}
+			return strings.ReplaceAll(s, "'", `"`)
+		},
+		func(s string) string { return unquotedKeyRegexp.ReplaceAllString(s, `$1"$2":`) },
+		func(s string) string {
+			return pyLiteralRegexp.ReplaceAllStringFunc(s, func(match string) string {
+				match = strings.Replace(match, "True", "true", 1)
+				match = strings.Replace(match, "False", "false", 1)
+				return strings.Replace(match, "None", "null", 1)
+			})
+		},
+		closeBrackets,
+	}
+
+	for _, fix := range fixes {
+		str = fix(str)
+		if json.Valid([]byte(str)) {
+			return str, true
+		}
+	}
+	return str, false
+}
+
+// 补齐被截断的括号与引号
+func closeBrackets(str string) string {
+	var (
+		stack  []byte
+		quoted = false
+		escape = false
+	)
+
+	for i := 0; i < len(str); i++ {
+		ch := str[i]
+		if escape {
+			escape = false
+			continue
+		}
+
+		switch {
+		case ch == '\\' && quoted:
+			escape = true
+		case ch == '"':
+			quoted = !quoted
+		case quoted:
+		case ch == '{':
+			stack = append(stack, '}')
+		case ch == '[':
+			stack = append(stack, ']')
+		case (ch == '}' || ch == ']') && len(stack) > 0:
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	if quoted {
+		str += `"`
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		str += string(stack[i])
+	}
+	return str
+}
+
+// 按 schema 对参数做类型矫正：字符串数字、字符串布尔、单值包装成数组、多余字段剔除、缺省值补全
+func coerceArgs(schema map[string]interface{}, value interface{}) interface{} {
+	if schema == nil {
+		return value
+	}
+
+	types := schemaType(schema)
+	switch {
+	case types["object"]:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			if str, o := value.(string); o {
+				if err := json.Unmarshal([]byte(str), &obj); err != nil {
+					return value
+				}
+			} else {
+				return value
+			}
+		}
+
+		properties, _ := schema["properties"].(map[string]interface{})
+		for key, prop := range properties {
+			sub, o := prop.(map[string]interface{})
+			if !o {
+				continue
+			}
+			if v, exists := obj[key]; exists {
+				obj[key] = coerceArgs(sub, v)
+			} else if def, has := sub["default"]; has && isRequired(schema, key) {
+				obj[key] = def
+			}
+		}
+
+		if additional, o := schema["additionalProperties"].(bool); o && !additional && properties != nil {
+			for key := range obj {
+				if _, exists := properties[key]; !exists {
+					delete(obj, key)
+				}
+			}
+		}
+		return obj
+
+	case types["array"]:
+		slice, ok := value.([]interface{})
+		if !ok {
+			slice = []interface{}{value}
+		}
+		if items, o := schema["items"].(map[string]interface{}); o {
+			for i := range slice {
+				slice[i] = coerceArgs(items, slice[i])
+			}
+		}
+		return slice
+
+	case types["integer"], types["number"]:
+		if str, ok := value.(string); ok {
+			if num, err := strconv.ParseFloat(strings.TrimSpace(str), 64); err == nil {
+				return num
+			}
+		}
+
+	case types["boolean"]:
+		if str, ok := value.(string); ok {
+			if b, err := strconv.ParseBool(strings.TrimSpace(str)); err == nil {
+				return b
+			}
+		}
+
+	case types["string"]:
+		switch v := value.(type) {
+		case float64, bool:
+			return fmt.Sprintf("%v", v)
+		}
+	}
+	return value
+}
+
+func schemaType(schema map[string]interface{}) map[string]bool {
+	types := make(map[string]bool)
+	switch t := schema["type"].(type) {
+	case string:
+		types[t] = true
+	case []interface{}:
+		for _, item := range t {
+			if str, ok := item.(string); ok {
+				types[str] = true
+			}
+		}
+	}
+	if len(types) == 0 && schema["properties"] != nil {
+		types["object"] = true
+	}
+	return types
+}
+
+func isRequired(schema map[string]interface{}, key string) bool {
+	required, _ := schema["required"].([]interface{})
+	for _, item := range required {
+		if item == key {
+			return true
+		}
+	}
+	return false
+}
+
+// 校验工具参数，返回矫正后的参数与未通过的约束
+func validateArgs(fn model.Keyv[interface{}], args interface{}) (interface{}, []string) {
+	schema := fn.GetKeyv("parameters")
+	if len(schema) == 0 {
+		return args, nil
+	}
+
+	if keyv, ok := args.(model.Keyv[interface{}]); ok {
+		args = map[string]interface{}(keyv)
+	}
+
+	args = coerceArgs(schema, args)
+	problems := common.ValidateSchema(schema, args)
+	if len(problems) > 0 {
+		logger.Warnf("tool '%s' arguments validation failed: %s", fn.GetString("name"), strings.Join(problems, "; "))
+	}
+	return args, problems
+}
+
+// 在原提示词后附上上一次的回复 content 及其问题，要求重新输出
+func repairMessage(message, content, name string, problems []string) string {
+	message += "\n\n" + fmt.Sprintf("上一次的回复：\n%s\n\n", content)
+	if name == "" {
+		return message + fmt.Sprintf("上一次的回复不符合要求：\n- %s\n必须选择一个工具并输出完整的工具调用 JSON。",
+			strings.Join(problems, "\n- "))
+	}
+	return message + fmt.Sprintf("上一次调用工具 `%s` 的参数不符合要求：\n- %s\n请修正后重新输出完整的工具调用 JSON。",
+		name, strings.Join(problems, "\n- "))
+}
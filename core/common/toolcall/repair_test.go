@@ -0,0 +1,223 @@
+package toolcall
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"chatgpt-adapter/core/common/vars"
+	"chatgpt-adapter/core/gin/model"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRepairJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+		ok    bool
+	}{
+		{"valid", `{"city":"hz"}`, `{"city":"hz"}`, true},
+		{"trailing comma", `{"a":1,"b":[1,2,],}`, `{"a":1,"b":[1,2]}`, true},
+		{"single quotes", `{'city':'hz'}`, `{"city":"hz"}`, true},
+		{"unquoted keys", `{city:"hz",days:3}`, `{"city":"hz","days":3}`, true},
+		{"python literals", `{"a":True,"b":False,"c":None}`, `{"a":true,"b":false,"c":null}`, true},
+		{"truncated", `{"city":"hz","tags":["a","b`, `{"city":"hz","tags":["a","b"]}`, true},
+		{"escaped quote", `{"q":"say \"hi`, `{"q":"say \"hi"}`, true},
+		{"not json", `hello`, `hello`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := repairJSON(tt.input)
+			if ok != tt.ok {
+				t.Fatalf("repairJSON(%q) ok = %v, want %v", tt.input, ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if !jsonEqual(t, got, tt.want) {
+				t.Errorf("repairJSON(%q) = %s, want %s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoerceArgs(t *testing.T) {
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"days":   map[string]interface{}{"type": "integer"},
+			"hourly": map[string]interface{}{"type": "boolean"},
+			"city":   map[string]interface{}{"type": "string"},
+			"tags":   map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			"unit":   map[string]interface{}{"type": "string", "default": "c"},
+		},
+		"required":             []interface{}{"city", "unit"},
+		"additionalProperties": false,
+	}
+
+	tests := []struct {
+		name  string
+		input interface{}
+		want  interface{}
+	}{
+		{
+			"string scalars",
+			map[string]interface{}{"city": "hz", "days": "3", "hourly": "true", "unit": "f"},
+			map[string]interface{}{"city": "hz", "days": 3.0, "hourly": true, "unit": "f"},
+		},
+		{
+			"number to string",
+			map[string]interface{}{"city": 100.0, "unit": "f"},
+			map[string]interface{}{"city": "100", "unit": "f"},
+		},
+		{
+			"wrap single value",
+			map[string]interface{}{"city": "hz", "tags": "sunny", "unit": "f"},
+			map[string]interface{}{"city": "hz", "tags": []interface{}{"sunny"}, "unit": "f"},
+		},
+		{
+			"default and extra fields",
+			map[string]interface{}{"city": "hz", "extra": 1.0},
+			map[string]interface{}{"city": "hz", "unit": "c"},
+		},
+		{
+			"object as string",
+			`{"city":"hz","unit":"f"}`,
+			map[string]interface{}{"city": "hz", "unit": "f"},
+		},
+		{
+			"invalid string kept",
+			"hz",
+			"hz",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := coerceArgs(schema, tt.input); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("coerceArgs() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateArgs(t *testing.T) {
+	fn := model.Keyv[interface{}]{
+		"name": "get_weather",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"city": map[string]interface{}{"type": "string"},
+				"days": map[string]interface{}{"type": "integer", "minimum": 1.0, "maximum": 7.0},
+				"unit": map[string]interface{}{"type": "string", "enum": []interface{}{"c", "f"}},
+			},
+			"required": []interface{}{"city"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		args     interface{}
+		problems int
+	}{
+		{"valid", map[string]interface{}{"city": "hz", "days": 3.0, "unit": "c"}, 0},
+		{"coerced", map[string]interface{}{"city": "hz", "days": "3"}, 0},
+		{"keyv args", model.Keyv[interface{}]{"city": "hz"}, 0},
+		{"missing required", map[string]interface{}{"days": 3.0}, 1},
+		{"out of range", map[string]interface{}{"city": "hz", "days": 10.0}, 1},
+		{"not in enum", map[string]interface{}{"city": "hz", "unit": "k"}, 1},
+		{"wrong type", map[string]interface{}{"city": map[string]interface{}{}}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, problems := validateArgs(fn, tt.args)
+			if len(problems) != tt.problems {
+				t.Errorf("validateArgs() problems = %v, want %d", problems, tt.problems)
+			}
+		})
+	}
+
+	t.Run("no schema", func(t *testing.T) {
+		args := map[string]interface{}{"any": 1.0}
+		got, problems := validateArgs(model.Keyv[interface{}]{"name": "noop"}, args)
+		if len(problems) != 0 || !reflect.DeepEqual(got, args) {
+			t.Errorf("validateArgs() = %v, %v", got, problems)
+		}
+	})
+}
+
+func jsonEqual(t *testing.T, a, b string) bool {
+	t.Helper()
+	var x, y interface{}
+	if err := json.Unmarshal([]byte(a), &x); err != nil {
+		t.Fatalf("unmarshal %s: %v", a, err)
+	}
+	if err := json.Unmarshal([]byte(b), &y); err != nil {
+		t.Fatalf("unmarshal %s: %v", b, err)
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+func TestRepairMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		tool     string
+		problems []string
+		want     []string
+	}{
+		{"no tool call", "", []string{"a tool call is required, but none was produced"}, []string{"必须选择一个工具", "a tool call is required"}},
+		{"invalid arguments", "get_weather", []string{"$.days: value must be <= 7"}, []string{"`get_weather`", "$.days: value must be <= 7"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := repairMessage("PROMPT", `{"toolId":"get_weather","arguments":{"days":10}}`, tt.tool, tt.problems)
+			if !strings.HasPrefix(got, "PROMPT\n\n") || !strings.Contains(got, `{"toolId":"get_weather","arguments":{"days":10}}`) {
+				t.Errorf("repairMessage() = %q, want the prompt and the previous output", got)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("repairMessage() = %q, want %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultTool(t *testing.T) {
+	tools := []model.Keyv[interface{}]{
+		{"type": "function", "function": map[string]interface{}{"name": "get_weather"}},
+		{"type": "function", "function": map[string]interface{}{"name": "search"}},
+	}
+	forced := map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": "get_weather"}}
+
+	tests := []struct {
+		name   string
+		id     string
+		choice interface{}
+		want   string
+	}{
+		{"no default", "-1", nil, "-1"},
+		{"default", "search", nil, "search"},
+		{"unknown default", "lookup", nil, "-1"},
+		{"required", "search", ChoiceRequired, "search"},
+		{"forced other tool", "search", forced, "-1"},
+		{"forced same tool", "get_weather", forced, "get_weather"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			ctx.Set(vars.GinTool, model.Keyv[interface{}]{"id": tt.id, "enabled": true})
+			completion := model.Completion{Tools: tools, ToolChoice: tt.choice}
+			if got := defaultTool(ctx, completion); got != tt.want {
+				t.Errorf("defaultTool() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,7 +2,12 @@ package toolcall
 
 import (
 	"bytes"
+	"fmt"
+	"strings"
 	"text/template"
+
+	"chatgpt-adapter/core/common/agent"
+	"chatgpt-adapter/core/gin/model"
 )
 
 type Builder struct {
@@ -23,6 +28,87 @@ func newBuilder(name string) *Builder {
 	}
 }
 
+func init() {
+	// 启动及热加载时用示例数据试渲染工具模板
+	for _, name := range []string{agent.NameToolTasks, agent.NameToolCall} {
+		agent.AddValidator(name, validateTemplate)
+	}
+}
+
+// 工具调用模板的变量与函数
+func newToolBuilder(tools []model.Keyv[interface{}], toolDef string, pMessages interface{}, excludeTaskContents interface{}, content string) *Builder {
+	return newBuilder("tool").
+		Vars("toolDef", toolDef).
+		Vars("tools", tools).
+		Vars("pMessages", pMessages).
+		Vars("excludeTaskContents", excludeTaskContents).
+		Vars("content", content).
+		Func("ToolId", func(str string) string {
+			return toolIdWithTools(str, tools)
+		}).
+		Func("Join", func(slice []interface{}, sep string) string {
+			if len(slice) == 0 {
+				return ""
+			}
+			var result []string
+			for _, v := range slice {
+				result = append(result, fmt.Sprintf("\"%v\"", v))
+			}
+			return strings.Join(result, sep)
+		}).
+		Func("Has", func(obj map[string]interface{}, key string) bool {
+			_, exists := obj[key]
+			return exists
+		}).
+		Func("Len", func(slice []interface{}) int {
+			return len(slice)
+		}).
+		Func("Enc", func(value interface{}) string {
+			return strings.ReplaceAll(fmt.Sprintf("%s", value), "\n", "\\n")
+		}).
+		Func("ToolDesc", func(value string) string {
+			for _, t := range tools {
+				fn := t.GetKeyv("function")
+				if !fn.Has("name") {
+					continue
+				}
+				if value == fn.GetString("name") {
+					return fn.GetString("description")
+				}
+			}
+			return ""
+		})
+}
+
+func validateTemplate(template string) error {
+	tools := []model.Keyv[interface{}]{
+		{
+			"type": "function",
+			"function": map[string]interface{}{
+				"id":          "abcde",
+				"name":        "get_weather",
+				"description": "Get the current weather",
+				"parameters": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"city": map[string]interface{}{"type": "string", "description": "city name"},
+					},
+					"required": []interface{}{"city"},
+				},
+			},
+		},
+	}
+	pMessages := []model.Keyv[interface{}]{
+		{"role": "system", "content": "You are a helpful assistant."},
+		{"role": "user", "content": "What's the weather like?"},
+		{"role": "assistant", "content": "", "tool_calls": []interface{}{}},
+		{"role": "tool", "name": "get_weather", "content": "sunny"},
+	}
+
+	_, err := newToolBuilder(tools, "-1", pMessages, "", "continue").String(template)
+	return err
+}
+
 func (bdr *Builder) Vars(key string, value interface{}) *Builder { bdr.ctx[key] = value; return bdr }
 func (bdr *Builder) Func(key string, fun interface{}) *Builder   { bdr.funcM[key] = fun; return bdr }
 func (bdr *Builder) String(template string) (result string, err error) {
@@ -6,6 +6,7 @@ var (
 	GinEmbedding       = "__embedding__"
 	GinMatchers        = "__matchers__"
 	GinCompletionUsage = "__completion-usage__"
+	GinFinishReason    = "__finish-reason__"
 	GinDebugger        = "__debug__"
 	GinEcho            = "__echo__"
 	GinTool            = "__tool__"
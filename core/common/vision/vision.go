@@ -0,0 +1,285 @@
+package vision
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/logger"
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/iocgo/sdk/env"
+	"github.com/patrickmn/go-cache"
+)
+
+// 图片输入配置：
+//
+//	vision:
+//	  fallback: drop        # 模型不支持图片时的处理：reject 拒绝请求 / drop 丢弃图片（默认）/ placeholder 替换为文字占位
+//	  placeholder: "[image]"
+//	  max-size: 20971520    # 单张图片的最大字节数
+//	  cache-size: 268435456 # 图片缓存占用的最大字节数，超出后不再缓存新图片
+const (
+	FallbackReject      = "reject"
+	FallbackDrop        = "drop"
+	FallbackPlaceholder = "placeholder"
+)
+
+type Image struct {
+	Hash string // 内容的哈希
+	Mime string
+	Data []byte
+}
+
+var (
+	fallback    = FallbackDrop
+	placeholder = "[image]"
+	maxSize     = 20 * 1024 * 1024
+	cacheSize   = int64(256 * 1024 * 1024)
+
+	// 按内容哈希缓存解码 / 下载后的图片，相同内容只保留一份
+	images = cache.New(30*time.Minute, 10*time.Minute)
+	cached atomic.Int64 // 缓存中图片的字节总数
+
+	// 远程地址 => 内容哈希，多轮对话重复发送同一地址时不再下载
+	remotes = cache.New(30*time.Minute, 10*time.Minute)
+
+	ErrUnsupported = errors.New("image input is not supported")
+)
+
+func init() {
+	inited.AddInitialized(func(env *env.Environment) {
+		if value := env.GetString("vision.fallback"); value != "" {
+			switch value {
+			case FallbackReject, FallbackDrop, FallbackPlaceholder:
+				fallback = value
+			default:
+				logger.Fatalf("vision.fallback: unknown value '%s'", value)
+			}
+		}
+		if value := env.GetString("vision.placeholder"); value != "" {
+			placeholder = value
+		}
+		if value := env.GetInt("vision.max-size"); value > 0 {
+			maxSize = value
+		}
+		if value := env.GetInt64("vision.cache-size"); value > 0 {
+			cacheSize = value
+		}
+	})
+
+	images.OnEvicted(func(_ string, value interface{}) {
+		cached.Add(-int64(len(value.(*Image).Data)))
+	})
+}
+
+// 读取 data url 或下载远程图片
+func Load(url string) (*Image, error) {
+	image, err := load(url)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(image.Mime, "image/") {
+		return nil, fmt.Errorf("unsupported image type: %s", image.Mime)
+	}
+	return image, nil
+}
+
+// 读取任意类型的附件，用于 file 类型的内容
+func LoadFile(url string) (*Image, error) {
+	return load(url)
+}
+
+func load(url string) (*Image, error) {
+	remote := strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
+	if remote {
+		if hash, ok := remotes.Get(common.CalcHex(url)); ok {
+			if value, o := images.Get(hash.(string)); o {
+				return value.(*Image), nil
+			}
+		}
+	}
+
+	var (
+		buffer []byte
+		err    error
+	)
+
+	switch {
+	case strings.HasPrefix(url, "data:"):
+		pos := strings.Index(url, ",")
+		if pos < 0 || !strings.Contains(url[:pos], ";base64") {
+			return nil, fmt.Errorf("invalid data url")
+		}
+		if size := base64.StdEncoding.DecodedLen(len(url) - pos - 1); size > maxSize+2 {
+			return nil, fmt.Errorf("file size %d exceeds %d", size, maxSize)
+		}
+		buffer, err = base64.StdEncoding.DecodeString(url[pos+1:])
+	case remote:
+		buffer, err = common.DownloadBufferN(common.HTTPClient, env.Env.GetString("server.proxied"), url, nil, int64(maxSize))
+	default:
+		return nil, fmt.Errorf("unsupported url: %.32s", url)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(buffer) > maxSize {
+		return nil, fmt.Errorf("file size %d exceeds %d", len(buffer), maxSize)
+	}
+
+	hash := common.CalcHex(string(buffer))
+	if remote {
+		remotes.SetDefault(common.CalcHex(url), hash)
+	}
+	if value, ok := images.Get(hash); ok {
+		return value.(*Image), nil
+	}
+
+	image := &Image{
+		Hash: hash,
+		Mime: mimetype.Detect(buffer).String(),
+		Data: buffer,
+	}
+	size := int64(len(buffer))
+	if cached.Load()+size <= cacheSize && images.Add(hash, image, cache.DefaultExpiration) == nil {
+		cached.Add(size)
+	}
+	return image, nil
+}
+
+func (image *Image) DataURL() string {
+	return "data:" + image.Mime + ";base64," + base64.StdEncoding.EncodeToString(image.Data)
+}
+
+// 保存到 tmp 目录，可通过 /file/ 访问
+func (image *Image) Save() (string, error) {
+	suffix := strings.TrimPrefix(mimetype.Lookup(image.Mime).Extension(), ".")
+	if suffix == "" {
+		suffix = "png"
+	}
+	return common.SaveBase64(base64.StdEncoding.EncodeToString(image.Data), suffix)
+}
+
+// 提取消息中的图片地址
+func URLs(message model.Keyv[interface{}]) (slice []string) {
+	if !message.IsSlice("content") {
+		return
+	}
+	for _, item := range message.GetSlice("content") {
+		part, ok := item.(map[string]interface{})
+		if !ok || part["type"] != "image_url" {
+			continue
+		}
+		if url := model.Keyv[interface{}](part).GetKeyv("image_url").GetString("url"); url != "" {
+			slice = append(slice, url)
+		}
+	}
+	return
+}
+
+// 消息中的附件：image_url 与 file 类型的内容
+type Attachment struct {
+	Name  string
+	URL   string
+	Image bool
+}
+
+// file 类型的内容：{"type": "file", "file": {"filename": "a.pdf", "file_data": "data:application/pdf;base64,..."}}
+func Attachments(message model.Keyv[interface{}]) (slice []Attachment) {
+	if !message.IsSlice("content") {
+		return
+	}
+	for _, item := range message.GetSlice("content") {
+		part, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		kv := model.Keyv[interface{}](part)
+		switch part["type"] {
+		case "image_url":
+			if url := kv.GetKeyv("image_url").GetString("url"); url != "" {
+				slice = append(slice, Attachment{URL: url, Image: true})
+			}
+		case "file":
+			file := kv.GetKeyv("file")
+			url := file.GetString("file_data")
+			if url == "" {
+				url = file.GetString("url")
+			}
+			if url != "" {
+				slice = append(slice, Attachment{Name: file.GetString("filename"), URL: url})
+			}
+		}
+	}
+	return
+}
+
+// 拼接消息中的文本内容
+func Text(message model.Keyv[interface{}]) string {
+	if !message.IsSlice("content") {
+		return message.GetString("content")
+	}
+
+	var texts []string
+	for _, item := range message.GetSlice("content") {
+		if part, ok := item.(map[string]interface{}); ok && part["type"] == "text" {
+			texts = append(texts, model.Keyv[interface{}](part).GetString("text"))
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+func HasImages(messages []model.Keyv[interface{}]) bool {
+	for _, message := range messages {
+		if len(URLs(message)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// 不支持图片的模型按 vision.fallback 处理，并把只剩文本的 content 数组合并为字符串
+func Degrade(messages []model.Keyv[interface{}]) ([]model.Keyv[interface{}], error) {
+	if fallback == FallbackReject && HasImages(messages) {
+		return nil, ErrUnsupported
+	}
+
+	result := make([]model.Keyv[interface{}], len(messages))
+	for index, message := range messages {
+		if !message.IsSlice("content") {
+			result[index] = message
+			continue
+		}
+
+		var texts []string
+		for _, item := range message.GetSlice("content") {
+			part, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			switch part["type"] {
+			case "text":
+				texts = append(texts, model.Keyv[interface{}](part).GetString("text"))
+			case "image_url":
+				if fallback == FallbackPlaceholder {
+					texts = append(texts, placeholder)
+				}
+			}
+		}
+
+		obj := make(model.Keyv[interface{}], len(message))
+		for k, v := range message {
+			obj[k] = v
+		}
+		obj["content"] = strings.Join(texts, "\n")
+		result[index] = obj
+	}
+	return result, nil
+}
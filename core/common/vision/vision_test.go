@@ -0,0 +1,198 @@
+package vision
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/core/gin/model"
+	"github.com/iocgo/sdk/env"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "vision")
+	if err != nil {
+		panic(err)
+	}
+
+	path := filepath.Join(dir, "config.yaml")
+	if err = os.WriteFile(path, []byte("vision:\n  max-size: 1024\n"), 0644); err != nil {
+		panic(err)
+	}
+	_ = os.Setenv("CONFIG_PATH", path)
+	environment, err := env.New()
+	if err != nil {
+		panic(err)
+	}
+	inited.Initialized(environment)
+
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// 生成 size x size 的 png，不同的 c 得到不同的内容
+func pngOf(t *testing.T, size int, c uint8) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for i := range img.Pix {
+		img.Pix[i] = c + uint8(i)
+	}
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func dataURL(mime string, data []byte) string {
+	return "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+func TestLoad(t *testing.T) {
+	data := pngOf(t, 4, 1)
+	tests := []struct {
+		name string
+		url  string
+		mime string
+		ok   bool
+	}{
+		{"png data url", dataURL("image/png", data), "image/png", true},
+		{"mime from content", dataURL("application/octet-stream", data), "image/png", true},
+		{"not an image", dataURL("text/plain", []byte("hello")), "", false},
+		{"not base64", "data:image/png,abc", "", false},
+		{"too large", dataURL("image/png", make([]byte, 2048)), "", false},
+		{"unsupported scheme", "file:///etc/passwd", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := Load(tt.url)
+			if (err == nil) != tt.ok {
+				t.Fatalf("Load() error = %v, want ok %v", err, tt.ok)
+			}
+			if err != nil {
+				return
+			}
+			if img.Mime != tt.mime || img.Hash != common.CalcHex(string(data)) || !bytes.Equal(img.Data, data) {
+				t.Errorf("Load() = %s %s, want %s %s", img.Mime, img.Hash, tt.mime, common.CalcHex(string(data)))
+			}
+		})
+	}
+}
+
+// 相同内容无论来源只缓存一份，远程地址重复使用时不再下载
+func TestLoadCachedByContent(t *testing.T) {
+	data := pngOf(t, 4, 2)
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write(data)
+	}))
+	defer server.Close()
+
+	first, err := Load(server.URL + "/a.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := Load(server.URL + "/a.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hits.Load() != 1 || again != first {
+		t.Errorf("same url downloaded %d times, cached = %v", hits.Load(), again == first)
+	}
+
+	other, err := Load(server.URL + "/b.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inline, err := Load(dataURL("image/png", data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other != first || inline != first {
+		t.Errorf("same content cached separately: %v %v", other == first, inline == first)
+	}
+	if first.Hash != common.CalcHex(string(data)) {
+		t.Errorf("Hash = %s, want the content hash", first.Hash)
+	}
+}
+
+func TestDegrade(t *testing.T) {
+	defer func(saved string) { fallback = saved }(fallback)
+	messages := []model.Keyv[interface{}]{
+		{"role": "system", "content": "be brief"},
+		{"role": "user", "content": []interface{}{
+			map[string]interface{}{"type": "text", "text": "what is this?"},
+			map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "https://example.com/a.png"}},
+		}},
+	}
+
+	tests := []struct {
+		fallback string
+		content  interface{}
+		ok       bool
+	}{
+		{FallbackDrop, "what is this?", true},
+		{FallbackPlaceholder, "what is this?\n[image]", true},
+		{FallbackReject, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fallback, func(t *testing.T) {
+			fallback = tt.fallback
+			result, err := Degrade(messages)
+			if !tt.ok {
+				if err != ErrUnsupported {
+					t.Errorf("Degrade() error = %v, want ErrUnsupported", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result[0]["content"] != "be brief" || result[1]["content"] != tt.content {
+				t.Errorf("Degrade() = %v", result)
+			}
+			if !messages[1].IsSlice("content") {
+				t.Error("Degrade() modified the original message")
+			}
+		})
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	message := model.Keyv[interface{}]{"role": "user", "content": []interface{}{
+		map[string]interface{}{"type": "text", "text": "read these"},
+		map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "https://example.com/a.png"}},
+		map[string]interface{}{"type": "file", "file": map[string]interface{}{"filename": "a.pdf", "file_data": "data:application/pdf;base64,JVBERg=="}},
+		map[string]interface{}{"type": "file", "file": map[string]interface{}{"url": "https://example.com/b.txt"}},
+	}}
+
+	want := []Attachment{
+		{URL: "https://example.com/a.png", Image: true},
+		{Name: "a.pdf", URL: "data:application/pdf;base64,JVBERg=="},
+		{URL: "https://example.com/b.txt"},
+	}
+	if got := Attachments(message); !reflect.DeepEqual(got, want) {
+		t.Errorf("Attachments() = %+v, want %+v", got, want)
+	}
+	if got := URLs(message); len(got) != 1 || got[0] != "https://example.com/a.png" {
+		t.Errorf("URLs() = %v", got)
+	}
+	if got := Text(message); got != "read these" {
+		t.Errorf("Text() = %q", got)
+	}
+}
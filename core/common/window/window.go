@@ -0,0 +1,254 @@
+package window
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/core/common/tokenizer"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/logger"
+	"github.com/iocgo/sdk/env"
+)
+
+// 上下文窗口配置，在 HandleMessages 之前按模型预算裁剪消息：
+//
+//	context-window:
+//	  strategy: drop-oldest     # drop-oldest（默认）/ last-n / summarize
+//	  tokens: 0                 # 未匹配模型的默认预算，0 不限制
+//	  reserve: 1024             # 为回复预留的 token
+//	  keep: 10                  # last-n 保留的最近消息数；summarize 至少原样保留的消息数
+//	  summary-model: gpt-4o-mini
+//	  models:
+//	    - model: "claude-3-5-*" # 支持通配符
+//	      tokens: 100000
+//	      strategy: summarize
+//	    - model: bing
+//	      tokens: 8000
+const (
+	StrategyDropOldest = "drop-oldest"
+	StrategyLastN      = "last-n"
+	StrategySummarize  = "summarize"
+)
+
+// 每条消息的格式开销
+const messageOverhead = 4
+
+type modelObj struct {
+	Model    string `mapstructure:"model"`
+	Tokens   int    `mapstructure:"tokens"`
+	Strategy string `mapstructure:"strategy"`
+	Keep     int    `mapstructure:"keep"`
+}
+
+type Budget struct {
+	Tokens   int
+	Strategy string
+	Keep     int
+}
+
+// 裁剪结果
+type Result struct {
+	Strategy string
+	Before   int
+	After    int
+	Dropped  int
+	Budget   int
+}
+
+var (
+	models       []modelObj
+	defaultObj   = Budget{Strategy: StrategyDropOldest, Keep: 10}
+	reserve      = 1024
+	summaryModel string
+)
+
+func init() {
+	inited.AddInitialized(func(env *env.Environment) {
+		if err := env.UnmarshalKey("context-window.models", &models); err != nil {
+			logger.Fatal(err)
+		}
+
+		defaultObj.Tokens = env.GetInt("context-window.tokens")
+		if strategy := env.GetString("context-window.strategy"); strategy != "" {
+			defaultObj.Strategy = strategy
+		}
+		if value := env.GetInt("context-window.keep"); value > 0 {
+			defaultObj.Keep = value
+		}
+		if env.IsSet("context-window.reserve") {
+			reserve = env.GetInt("context-window.reserve")
+		}
+		summaryModel = env.GetString("context-window.summary-model")
+
+		check(defaultObj.Strategy, "context-window.strategy")
+		for i, obj := range models {
+			check(obj.Strategy, fmt.Sprintf("context-window.models[%d].strategy", i))
+		}
+	})
+}
+
+func check(strategy, key string) {
+	switch strategy {
+	case "", StrategyDropOldest, StrategyLastN:
+	case StrategySummarize:
+		if summaryModel == "" {
+			logger.Fatalf("%s: summarize requires `context-window.summary-model`", key)
+		}
+	default:
+		logger.Fatalf("%s: unknown strategy '%s'", key, strategy)
+	}
+}
+
+func SummaryModel() string { return summaryModel }
+
+// 按配置顺序匹配模型，未匹配时使用默认预算；预算已扣除回复预留
+func BudgetOf(mod string, maxTokens int) (budget Budget) {
+	budget = defaultObj
+	for _, obj := range models {
+		if ok, _ := path.Match(obj.Model, mod); ok || obj.Model == mod {
+			budget.Tokens = obj.Tokens
+			if obj.Strategy != "" {
+				budget.Strategy = obj.Strategy
+			}
+			if obj.Keep > 0 {
+				budget.Keep = obj.Keep
+			}
+			break
+		}
+	}
+
+	if budget.Tokens <= 0 {
+		return
+	}
+
+	if maxTokens > 0 && maxTokens < budget.Tokens/2 {
+		budget.Tokens -= maxTokens
+	} else {
+		budget.Tokens -= reserve
+	}
+	if budget.Tokens <= 0 {
+		budget.Tokens = 1
+	}
+	return
+}
+
+func CountMessage(mod string, message model.Keyv[interface{}]) int {
+	tokens := messageOverhead
+	if message.IsSlice("content") {
+		for _, item := range message.GetSlice("content") {
+			if kv, ok := item.(map[string]interface{}); ok && kv["type"] == "text" {
+				tokens += tokenizer.Count(mod, model.Keyv[interface{}](kv).GetString("text"))
+			}
+		}
+	} else {
+		tokens += tokenizer.Count(mod, message.GetString("content"))
+	}
+
+	for _, item := range message.GetSlice("tool_calls") {
+		if kv, ok := item.(map[string]interface{}); ok {
+			fn := model.Keyv[interface{}](kv).GetKeyv("function")
+			tokens += tokenizer.Count(mod, fn.GetString("name")+fn.GetString("arguments"))
+		}
+	}
+	return tokens
+}
+
+func Count(mod string, messages []model.Keyv[interface{}]) (tokens int) {
+	for _, message := range messages {
+		tokens += CountMessage(mod, message)
+	}
+	return
+}
+
+// 拆分出开头的 system 消息
+func Split(messages []model.Keyv[interface{}]) (system, rest []model.Keyv[interface{}]) {
+	pos := 0
+	for pos < len(messages) && messages[pos].Is("role", "system") {
+		pos++
+	}
+	return messages[:pos], messages[pos:]
+}
+
+// 从后往前保留能放入预算的消息，返回保留部分的起始下标；最后一条消息始终保留。
+// 起始位置不能落在 tool 消息上，否则其对应的 tool_calls 已被丢弃
+func Fit(mod string, messages []model.Keyv[interface{}], budget int) int {
+	pos := len(messages)
+	for pos > 0 {
+		tokens := CountMessage(mod, messages[pos-1])
+		if budget-tokens < 0 && pos < len(messages) {
+			break
+		}
+		budget -= tokens
+		pos--
+	}
+
+	for pos < len(messages)-1 && messages[pos].Is("role", "tool") {
+		pos++
+	}
+	return pos
+}
+
+// 丢弃最早的对话直至放入预算，system 消息保留
+func DropOldest(mod string, messages []model.Keyv[interface{}], budget int) ([]model.Keyv[interface{}], int) {
+	system, rest := Split(messages)
+	pos := Fit(mod, rest, budget-Count(mod, system))
+	return join(system, rest[pos:]), pos
+}
+
+// 保留 system 与最近 keep 条消息，仍超出预算时继续丢弃最早的对话
+func LastN(mod string, messages []model.Keyv[interface{}], keep, budget int) ([]model.Keyv[interface{}], int) {
+	system, rest := Split(messages)
+	dropped := 0
+	if len(rest) > keep {
+		dropped = len(rest) - keep
+		for dropped < len(rest)-1 && rest[dropped].Is("role", "tool") {
+			dropped++
+		}
+		rest = rest[dropped:]
+	}
+
+	result, pos := DropOldest(mod, join(system, rest), budget)
+	return result, dropped + pos
+}
+
+func join(system, rest []model.Keyv[interface{}]) []model.Keyv[interface{}] {
+	result := make([]model.Keyv[interface{}], 0, len(system)+len(rest))
+	return append(append(result, system...), rest...)
+}
+
+// 响应头 X-Context-Window 的内容
+func (r Result) String() string {
+	return fmt.Sprintf("%s; dropped=%d; tokens=%d/%d; before=%d", r.Strategy, r.Dropped, r.After, r.Budget, r.Before)
+}
+
+// 将早期对话转写为纯文本，供摘要模型使用
+func Transcript(messages []model.Keyv[interface{}]) string {
+	var builder strings.Builder
+	for _, message := range messages {
+		content := message.GetString("content")
+		if message.IsSlice("content") {
+			content = ""
+			for _, item := range message.GetSlice("content") {
+				if kv, ok := item.(map[string]interface{}); ok && kv["type"] == "text" {
+					content += model.Keyv[interface{}](kv).GetString("text")
+				}
+			}
+		}
+		for _, item := range message.GetSlice("tool_calls") {
+			if kv, ok := item.(map[string]interface{}); ok {
+				fn := model.Keyv[interface{}](kv).GetKeyv("function")
+				content += fmt.Sprintf("\n[call %s(%s)]", fn.GetString("name"), fn.GetString("arguments"))
+			}
+		}
+		if content == "" {
+			continue
+		}
+		builder.WriteString(message.GetString("role"))
+		builder.WriteString(": ")
+		builder.WriteString(strings.TrimSpace(content))
+		builder.WriteString("\n\n")
+	}
+	return builder.String()
+}
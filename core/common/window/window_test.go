@@ -0,0 +1,115 @@
+package window
+
+import (
+	"slices"
+	"testing"
+
+	"chatgpt-adapter/core/gin/model"
+)
+
+const testModel = "gpt-4o"
+
+func testMessages() []model.Keyv[interface{}] {
+	return []model.Keyv[interface{}]{
+		{"role": "system", "content": "You are a helpful assistant."},
+		{"role": "user", "content": "What's the weather like in Hangzhou?"},
+		{"role": "assistant", "content": "", "tool_calls": []interface{}{
+			map[string]interface{}{
+				"id":       "call_1",
+				"type":     "function",
+				"function": map[string]interface{}{"name": "get_weather", "arguments": `{"city":"hangzhou"}`},
+			},
+		}},
+		{"role": "tool", "tool_call_id": "call_1", "content": "sunny, 25 degrees"},
+		{"role": "user", "content": "Where should I go today?"},
+		{"role": "assistant", "content": "West Lake is a good choice on a sunny day."},
+		{"role": "user", "content": "How do I get there?"},
+	}
+}
+
+func roles(messages []model.Keyv[interface{}]) (slice []string) {
+	for _, message := range messages {
+		slice = append(slice, message.GetString("role"))
+	}
+	return
+}
+
+func TestFit(t *testing.T) {
+	messages := testMessages()[1:]
+	last := func(n int) int { return Count(testModel, messages[len(messages)-n:]) }
+
+	tests := []struct {
+		name   string
+		budget int
+		want   int
+	}{
+		{"everything fits", Count(testModel, messages), 0},
+		{"last two", last(2), len(messages) - 2},
+		{"one token short of three", last(3) - 1, len(messages) - 2},
+		{"last message always kept", 0, len(messages) - 1},
+		{"does not start on tool", last(4), len(messages) - 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Fit(testModel, messages, tt.budget); got != tt.want {
+				t.Errorf("Fit() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDropOldest(t *testing.T) {
+	messages := testMessages()
+	system := CountMessage(testModel, messages[0])
+	last := func(n int) int { return system + Count(testModel, messages[len(messages)-n:]) }
+
+	tests := []struct {
+		name    string
+		budget  int
+		roles   []string
+		dropped int
+	}{
+		{"everything fits", Count(testModel, messages), roles(messages), 0},
+		{"keeps system", last(2), []string{"system", "assistant", "user"}, 4},
+		{"skips orphan tool result", last(4), []string{"system", "user", "assistant", "user"}, 3},
+		{"budget below system", 0, []string{"system", "user"}, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, dropped := DropOldest(testModel, messages, tt.budget)
+			if got := roles(result); !slices.Equal(got, tt.roles) || dropped != tt.dropped {
+				t.Errorf("DropOldest() = %v, %d, want %v, %d", got, dropped, tt.roles, tt.dropped)
+			}
+		})
+	}
+}
+
+func TestLastN(t *testing.T) {
+	messages := testMessages()
+	system := CountMessage(testModel, messages[0])
+	unlimited := Count(testModel, messages)
+
+	tests := []struct {
+		name    string
+		keep    int
+		budget  int
+		roles   []string
+		dropped int
+	}{
+		{"keep more than available", 10, unlimited, roles(messages), 0},
+		{"keep last three", 3, unlimited, []string{"system", "user", "assistant", "user"}, 3},
+		{"skips orphan tool result", 4, unlimited, []string{"system", "user", "assistant", "user"}, 3},
+		{"budget still applies", 3, system + Count(testModel, messages[len(messages)-2:]), []string{"system", "assistant", "user"}, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, dropped := LastN(testModel, messages, tt.keep, tt.budget)
+			if got := roles(result); !slices.Equal(got, tt.roles) || dropped != tt.dropped {
+				t.Errorf("LastN() = %v, %d, want %v, %d", got, dropped, tt.roles, tt.dropped)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package gin
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"chatgpt-adapter/core/cache"
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/common/pricing"
+	"chatgpt-adapter/core/common/vars"
+	"chatgpt-adapter/core/gin/inter"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"chatgpt-adapter/core/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/iocgo/sdk/env"
+)
+
+// 响应缓存配置：
+//
+//	response-cache:
+//	  enabled: true
+//	  max-size: 1048576   # 单条缓存的最大字节数，超出不缓存
+//
+// 过期时间为 cache.ttl.response（默认 10m），存储后端跟随 cache.type。
+// 默认只缓存显式传入 temperature 为 0 的请求，其余请求需携带 X-Cache-Force: true 显式开启
+const (
+	cacheHeader       = "X-Cache"
+	cacheBypassHeader = "X-Cache-Bypass"
+	cacheForceHeader  = "X-Cache-Force"
+)
+
+func needCache(gtx *gin.Context, completion model.Completion) bool {
+	if !env.Env.GetBool("response-cache.enabled") || completion.N > 1 {
+		return false
+	}
+
+	if headerIs(gtx, cacheBypassHeader) {
+		return false
+	}
+	control := strings.ToLower(gtx.GetHeader("Cache-Control"))
+	if strings.Contains(control, "no-cache") || strings.Contains(control, "no-store") {
+		return false
+	}
+
+	// 采样的回复不应被固定下来，未传 temperature 时上游按默认值采样
+	return completion.GetTemperature(-1) == 0 || headerIs(gtx, cacheForceHeader)
+}
+
+func headerIs(gtx *gin.Context, key string) bool {
+	value := strings.ToLower(gtx.GetHeader(key))
+	return value == "1" || value == "true"
+}
+
+// 以客户端 key 与完整请求计算缓存键：模型、消息、工具、采样参数以及工具调用模式，不同客户端互不命中。
+// 流式与否不参与计算，命中时按本次请求的格式回放
+func cacheKey(gtx *gin.Context, completion model.Completion) (string, error) {
+	completion.Stream = false
+	completion.StreamOptions = nil
+	completion.ConversationId = ""
+	bytes, err := json.Marshal(struct {
+		Key        string                  `json:"key"`
+		Completion model.Completion        `json:"completion"`
+		Tool       model.Keyv[interface{}] `json:"tool"`
+	}{pricing.KeyOf(gtx.GetString("token")), completion, common.GetGinToolValue(gtx)})
+	if err != nil {
+		return "", err
+	}
+	return common.CalcHex(string(bytes)), nil
+}
+
+func completeCache(gtx *gin.Context, extension inter.Adapter, completion model.Completion) {
+	key, err := cacheKey(gtx, completion)
+	if err != nil {
+		logger.Error(err)
+		complete(gtx, extension, completion)
+		return
+	}
+
+	cacheManager := cache.ResponseCacheManager()
+	value, err := cacheManager.GetValue(key)
+	if err != nil {
+		logger.Error(err)
+	}
+
+	if value != "" {
+		var res model.Response
+		if err = json.Unmarshal([]byte(value), &res); err == nil && len(res.Choices) > 0 && res.Choices[0].Message != nil {
+			logger.Infof("response cache hit: %s", key)
+			gtx.Header(cacheHeader, "HIT")
+			replay(gtx, res, completion.Stream)
+			return
+		}
+	}
+
+	gtx.Header(cacheHeader, "MISS")
+	res, ok := capture(gtx, completion, func(ctx *gin.Context) {
+		complete(ctx, extension, completion)
+	})
+	if ok {
+		storeCache(key, res)
+	}
+}
+
+// 将 run 的输出转发给 gtx 的同时拼接出完整的响应。
+// 上游出错时直接返回错误，ok 为 false
+func capture(gtx *gin.Context, completion model.Completion, run func(ctx *gin.Context)) (res model.Response, ok bool) {
+	rec := newRecorder(gtx.Writer)
+	ctx := gtx.Copy()
+	ctx.Writer = rec
+
+	var chunks *chunkCollector
+	if completion.Stream {
+		chunks = &chunkCollector{gtx: gtx}
+		rec.event = chunks.collect
+	}
+	run(ctx)
+
+	if completion.Stream {
+		if !chunks.streamed {
+			code, e := rec.error()
+			response.Error(gtx, code, e)
+			return
+		}
+		return chunks.response(), true
+	}
+
+	if err := json.Unmarshal(rec.buffer.Bytes(), &res); err != nil || res.Error != nil || len(res.Choices) == 0 {
+		code, e := rec.error()
+		response.Error(gtx, code, e)
+		return
+	}
+	for k, v := range rec.header {
+		gtx.Writer.Header()[k] = v
+	}
+	gtx.Data(rec.status, "application/json; charset=utf-8", rec.buffer.Bytes())
+	return res, true
+}
+
+func storeCache(key string, res model.Response) {
+	if len(res.Choices) == 0 || res.Choices[0].Message == nil {
+		return
+	}
+	// 只缓存正常结束的回复，截断或中断的不缓存
+	if reason := res.Choices[0].FinishReason; reason == nil || *reason != "stop" && *reason != "tool_calls" {
+		return
+	}
+
+	bytes, err := json.Marshal(res)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	maxSize := env.Env.GetInt("response-cache.max-size")
+	if maxSize <= 0 {
+		maxSize = 1024 * 1024
+	}
+	if len(bytes) > maxSize {
+		logger.Warnf("response cache skipped, size %d exceeds %d", len(bytes), maxSize)
+		return
+	}
+
+	if err = cache.ResponseCacheManager().SetValue(key, string(bytes)); err != nil {
+		logger.Error(err)
+	}
+}
+
+// 按请求的格式回放缓存的响应
+func replay(gtx *gin.Context, res model.Response, stream bool) {
+	message := res.Choices[0].Message
+	if res.Choices[0].FinishReason != nil {
+		gtx.Set(vars.GinFinishReason, *res.Choices[0].FinishReason)
+	}
+	gtx.Set(vars.GinCompletionUsage, res.Usage)
+
+	if !stream {
+		res.Created = time.Now().Unix()
+		if env.Env.GetBool("server.no-usage") {
+			res.Usage = response.DefaultUsage
+		}
+		gtx.JSON(http.StatusOK, res)
+		return
+	}
+
+	if len(message.ToolCalls) > 0 {
+		response.SSEToolCallsResponse(gtx, res.Model, message.ToolCalls, time.Now().Unix())
+		return
+	}
+	response.Echo(gtx, res.Model, message.Content, true)
+}
+
+// 转发流式数据块的同时拼接出完整的响应
+type chunkCollector struct {
+	gtx      *gin.Context
+	streamed bool
+
+	model        string
+	id           string
+	content      strings.Builder
+	toolCalls    []model.Keyv[interface{}]
+	finishReason *string
+	usage        map[string]interface{}
+}
+
+func (c *chunkCollector) collect(data []byte) {
+	c.gtx.Writer.Header().Set("Content-Type", "text/event-stream")
+	if _, err := c.gtx.Writer.Write(append(data, '\n', '\n')); err != nil {
+		logger.Error(err)
+		return
+	}
+	c.gtx.Writer.Flush()
+	c.streamed = true
+
+	if !bytes.HasPrefix(data, []byte("data: ")) || string(data[6:]) == "[DONE]" {
+		return
+	}
+
+	var chunk model.Response
+	if err := json.Unmarshal(data[6:], &chunk); err != nil {
+		return
+	}
+	if chunk.Usage != nil {
+		c.usage = chunk.Usage
+	}
+	if len(chunk.Choices) == 0 {
+		return
+	}
+
+	// matcher 输出的数据块不带真实模型名
+	if chunk.Model != "matcher" {
+		c.model, c.id = chunk.Model, chunk.Id
+	}
+	// n > 1 时只拼接第一个 choice
+	choice := chunk.Choices[0]
+	if choice.Index != 0 {
+		return
+	}
+	if choice.FinishReason != nil {
+		c.finishReason = choice.FinishReason
+	}
+	if choice.Delta == nil {
+		return
+	}
+
+	c.content.WriteString(choice.Delta.Content)
+	for _, call := range choice.Delta.ToolCalls {
+		c.mergeToolCall(call)
+	}
+}
+
+// 按 index 合并分段的工具调用参数
+func (c *chunkCollector) mergeToolCall(call model.Keyv[interface{}]) {
+	index := len(c.toolCalls) - 1
+	if value, ok := call["index"].(float64); ok {
+		index = int(value)
+	}
+
+	fn := call.GetKeyv("function")
+	if index < 0 || index >= len(c.toolCalls) {
+		delete(call, "index")
+		c.toolCalls = append(c.toolCalls, call)
+		return
+	}
+
+	last := c.toolCalls[index].GetKeyv("function")
+	if last == nil {
+		c.toolCalls[index]["function"] = map[string]interface{}(fn)
+		return
+	}
+	if name := fn.GetString("name"); name != "" {
+		last["name"] = name
+	}
+	last["arguments"] = last.GetString("arguments") + fn.GetString("arguments")
+}
+
+func (c *chunkCollector) response() model.Response {
+	res := model.Response{
+		Id:      c.id,
+		Model:   c.model,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Choices: []model.Choice{{Index: 0, FinishReason: c.finishReason}},
+		Usage:   c.usage,
+	}
+
+	res.Choices[0].Message = &struct {
+		Role      string                    `json:"role,omitempty"`
+		Content   string                    `json:"content,omitempty"`
+		ToolCalls []model.Keyv[interface{}] `json:"tool_calls,omitempty"`
+	}{Role: "assistant", Content: c.content.String(), ToolCalls: c.toolCalls}
+	return res
+}
@@ -0,0 +1,40 @@
+package gin
+
+import (
+	"testing"
+
+	"chatgpt-adapter/core/gin/model"
+)
+
+func TestNeedCache(t *testing.T) {
+	zero, sampled := float32(0), float32(0.7)
+	tests := []struct {
+		name        string
+		temperature *float32
+		n           int
+		headers     map[string]string
+		want        bool
+	}{
+		{"temperature omitted", nil, 0, nil, false},
+		{"explicit zero", &zero, 0, nil, true},
+		{"sampled", &sampled, 0, nil, false},
+		{"forced", nil, 0, map[string]string{cacheForceHeader: "true"}, true},
+		{"forced sampled", &sampled, 0, map[string]string{cacheForceHeader: "1"}, true},
+		{"bypass", &zero, 0, map[string]string{cacheBypassHeader: "true"}, false},
+		{"no-cache", &zero, 0, map[string]string{"Cache-Control": "no-cache"}, false},
+		{"multiple choices", &zero, 2, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gtx, _ := newTestContext()
+			for k, v := range tt.headers {
+				gtx.Request.Header.Set(k, v)
+			}
+			completion := model.Completion{Model: "a/main", Temperature: tt.temperature, N: tt.n}
+			if got := needCache(gtx, completion); got != tt.want {
+				t.Errorf("needCache() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
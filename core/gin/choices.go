@@ -0,0 +1,246 @@
+package gin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"chatgpt-adapter/core/common/vars"
+	"chatgpt-adapter/core/gin/inter"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"chatgpt-adapter/core/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/iocgo/sdk/env"
+)
+
+const (
+	maxChoices = 128
+)
+
+// 记录单个 choice 的输出，流式时每收到一个完整的事件就回调 event
+type recorder struct {
+	gin.ResponseWriter
+
+	header  http.Header
+	status  int
+	size    int
+	written bool
+	buffer  bytes.Buffer
+	event   func(data []byte)
+}
+
+func newRecorder(w gin.ResponseWriter) *recorder {
+	return &recorder{
+		ResponseWriter: w,
+		header:         make(http.Header),
+		status:         http.StatusOK,
+	}
+}
+
+func (r *recorder) Header() http.Header { return r.header }
+func (r *recorder) Status() int         { return r.status }
+func (r *recorder) Size() int           { return r.size }
+func (r *recorder) Written() bool       { return r.written }
+func (r *recorder) WriteHeaderNow()     { r.written = true }
+func (r *recorder) Flush()              {}
+
+func (r *recorder) WriteHeader(code int) {
+	if code > 0 && !r.written {
+		r.status = code
+	}
+}
+
+func (r *recorder) WriteString(s string) (int, error) { return r.Write([]byte(s)) }
+func (r *recorder) Write(data []byte) (int, error) {
+	r.written = true
+	r.size += len(data)
+	r.buffer.Write(data)
+	if r.event != nil && r.isSSE() {
+		r.drain()
+	}
+	return len(data), nil
+}
+
+func (r *recorder) isSSE() bool {
+	return strings.Contains(r.header.Get("Content-Type"), "text/event-stream")
+}
+
+func (r *recorder) drain() {
+	for {
+		idx := bytes.Index(r.buffer.Bytes(), []byte("\n\n"))
+		if idx < 0 {
+			return
+		}
+
+		data := make([]byte, idx)
+		copy(data, r.buffer.Next(idx+2))
+		r.event(data)
+	}
+}
+
+// 非正常输出时，提取错误信息
+func (r *recorder) error() (code int, err error) {
+	code = r.status
+	if code == http.StatusOK {
+		code = http.StatusInternalServerError
+	}
+
+	var res model.Response
+	if e := json.Unmarshal(r.buffer.Bytes(), &res); e == nil && res.Error != nil {
+		return code, errors.New(res.Error.Message)
+	}
+	return code, errors.New("EMPTY RESPONSE")
+}
+
+// n > 1 时并发请求适配器，并按 index 合并 choices。
+// 并发数受 server.choices-concurrency 限制（默认 3），避免一次性占满账号池
+func completeChoices(gtx *gin.Context, extension inter.Adapter, completion model.Completion) {
+	var (
+		n        = completion.N
+		created  = time.Now().Unix()
+		streamed = false
+
+		mu sync.Mutex
+		wg sync.WaitGroup
+
+		recorders = make([]*recorder, n)
+		usages    = make([]map[string]interface{}, n)
+	)
+
+	concurrency := env.Env.GetInt("server.choices-concurrency")
+	if concurrency <= 0 {
+		concurrency = 3
+	}
+
+	logger.Infof("complete %d choices, concurrency: %d", n, concurrency)
+	semaphore := make(chan struct{}, concurrency)
+	completion.N = 0
+
+	for index := 0; index < n; index++ {
+		rec := newRecorder(gtx.Writer)
+		if completion.Stream {
+			rec.event = func(data []byte) {
+				mu.Lock()
+				defer mu.Unlock()
+				if forwardChunk(gtx, index, created, data, usages) {
+					streamed = true
+				}
+			}
+		}
+		recorders[index] = rec
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					logger.Errorf("complete choice[%d] panic: %v", index, r)
+				}
+			}()
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			ctx := gtx.Copy()
+			ctx.Writer = rec
+			ctx.Set(vars.GinCompletion, completion)
+			ctx.Set(vars.GinMatchers, newMatchers(ctx, completion))
+			complete(ctx, extension, completion)
+		}()
+	}
+	wg.Wait()
+
+	if completion.Stream {
+		if !streamed {
+			code, err := recorders[0].error()
+			response.Error(gtx, code, err)
+			return
+		}
+
+		for index, rec := range recorders {
+			if !rec.isSSE() {
+				_, err := rec.error()
+				logger.Errorf("complete choice[%d] failed: %v", index, err)
+			}
+		}
+
+		gtx.Set(vars.GinCompletionUsage, response.MergeUsage(usages, true))
+		response.SSEUsage(gtx, completion.Model, created)
+		response.Event(gtx, "", "[DONE]")
+		return
+	}
+
+	var result model.Response
+	for index, rec := range recorders {
+		var res model.Response
+		if err := json.Unmarshal(rec.buffer.Bytes(), &res); err != nil || res.Error != nil || len(res.Choices) == 0 {
+			code, e := rec.error()
+			response.Error(gtx, code, e)
+			return
+		}
+
+		if index == 0 {
+			result = res
+			result.Choices = make([]model.Choice, 0, n)
+		}
+
+		choice := res.Choices[0]
+		choice.Index = index
+		result.Choices = append(result.Choices, choice)
+		usages[index] = res.Usage
+	}
+
+	result.Id = fmt.Sprintf("chatcmpl-%d", created)
+	result.Created = created
+
+	result.Usage = response.MergeUsage(usages, true)
+	if env.Env.GetBool("server.no-usage") {
+		result.Usage = response.DefaultUsage
+	}
+	gtx.JSON(http.StatusOK, result)
+}
+
+// 改写数据块中 choices 的 index 并转发给客户端，用量块只做记录；
+// 各个 choice 的 id 与 created 统一为本次响应的值
+func forwardChunk(gtx *gin.Context, index int, created int64, data []byte, usages []map[string]interface{}) bool {
+	if !bytes.HasPrefix(data, []byte("data: ")) {
+		return false
+	}
+
+	data = data[6:]
+	if string(data) == "[DONE]" {
+		return false
+	}
+
+	var chunk map[string]interface{}
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		logger.Error(err)
+		return false
+	}
+
+	choices, _ := chunk["choices"].([]interface{})
+	if len(choices) == 0 {
+		if usage, ok := chunk["usage"].(map[string]interface{}); ok {
+			usages[index] = usage
+		}
+		return false
+	}
+
+	for _, value := range choices {
+		if choice, ok := value.(map[string]interface{}); ok {
+			choice["index"] = index
+		}
+	}
+
+	chunk["id"] = fmt.Sprintf("chatcmpl-%d", created)
+	chunk["created"] = created
+
+	response.Event(gtx, "", chunk)
+	return true
+}
@@ -0,0 +1,83 @@
+package gin
+
+import (
+	"net/http"
+
+	"chatgpt-adapter/core/common/conversation"
+	"chatgpt-adapter/core/common/pricing"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"chatgpt-adapter/core/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/iocgo/sdk/env"
+)
+
+const conversationHeader = "X-Conversation-Id"
+
+// 携带 conversation_id 时只需发送本轮的新消息，由服务端拼接历史记录。
+// 返回拼接后的请求以及本轮的新消息
+func mergeConversation(gtx *gin.Context, completion model.Completion) (model.Completion, []model.Keyv[interface{}], bool) {
+	if completion.ConversationId == "" {
+		return completion, nil, true
+	}
+	if !conversation.Enabled() {
+		logger.Warn("conversation is disabled, ignored conversation_id")
+		completion.ConversationId = ""
+		return completion, nil, true
+	}
+
+	id, ok := conversation.NewId(completion.ConversationId)
+	if !ok {
+		response.Error(gtx, http.StatusBadRequest, "invalid conversation_id")
+		return completion, nil, false
+	}
+
+	// 其他客户端的会话按不存在处理，不暴露其是否存在
+	owner := conversationOwner(gtx)
+	if !conversation.Usable(id, owner) {
+		response.Error(gtx, http.StatusNotFound, "conversation not found")
+		return completion, nil, false
+	}
+
+	messages := completion.Messages
+	completion.ConversationId = id
+	completion.Messages = conversation.Merge(id, owner, messages)
+	gtx.Header(conversationHeader, id)
+	logger.Infof("conversation %s: %d messages", id, len(completion.Messages))
+	return completion, messages, true
+}
+
+// 转发响应的同时记录助手回复，上游出错时本轮消息不入库
+func completeConversation(gtx *gin.Context, completion model.Completion, messages []model.Keyv[interface{}], run func(ctx *gin.Context)) {
+	res, ok := capture(gtx, completion, run)
+	if !ok {
+		return
+	}
+
+	var reply model.Keyv[interface{}]
+	if len(res.Choices) > 0 && res.Choices[0].Message != nil {
+		message := res.Choices[0].Message
+		reply = model.Keyv[interface{}]{
+			"role":    "assistant",
+			"content": message.Content,
+		}
+		if len(message.ToolCalls) > 0 {
+			toolCalls := make([]interface{}, len(message.ToolCalls))
+			for index, call := range message.ToolCalls {
+				toolCalls[index] = map[string]interface{}(call)
+			}
+			reply["tool_calls"] = toolCalls
+		}
+	}
+	conversation.Append(completion.ConversationId, conversationOwner(gtx), completion.Model, messages, reply)
+}
+
+// 会话归属的客户端 key；持有 server.password 的管理员返回空，可访问全部会话
+func conversationOwner(gtx *gin.Context) string {
+	token := gtx.GetString("token")
+	password := env.Env.GetString("server.password")
+	if password != "" && password == token {
+		return ""
+	}
+	return pricing.KeyOf(token)
+}
@@ -0,0 +1,62 @@
+package gin
+
+import (
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/common/pricing"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"github.com/gin-gonic/gin"
+	"github.com/iocgo/sdk/env"
+)
+
+// 记录一次上游请求的费用，没有用量（请求失败）时不记录
+func trackCost(gtx *gin.Context, token, mod string) {
+	usage := common.GetGinCompletionUsage(gtx)
+	if usage == nil {
+		return
+	}
+
+	prompt, completion, cached, estimated := response.UsageTokens(usage)
+	pricing.Track(token, mod, pricing.Usage{
+		Prompt:    prompt,
+		Output:    completion,
+		Cached:    cached,
+		Estimated: estimated,
+	})
+}
+
+func trackImages(gtx *gin.Context, token string, generation model.Generation) {
+	if status := gtx.Writer.Status(); status < 200 || status >= 300 {
+		return
+	}
+
+	n := generation.N
+	if n <= 0 {
+		n = 1
+	}
+	pricing.Track(token, generation.Model, pricing.Usage{Images: n})
+}
+
+// 设置了 server.password 时，只有持有该密码的请求可以查询所有 key 的费用，其余只能查询自己的
+func costQuery(gtx *gin.Context) pricing.Query {
+	query := pricing.Query{
+		Model: gtx.Query("model"),
+		From:  gtx.Query("from"),
+		To:    gtx.Query("to"),
+	}
+	if day := gtx.Query("day"); day != "" {
+		query.From, query.To = day, day
+	}
+
+	token := gtx.GetString("token")
+	password := env.Env.GetString("server.password")
+	if password != "" && password != token {
+		query.Key = pricing.KeyOf(token)
+		return query
+	}
+
+	if key := gtx.Query("key"); key != "" {
+		query.Key = pricing.KeyOf(key)
+	}
+	return query
+}
@@ -0,0 +1,35 @@
+package gin
+
+import (
+	"net/http"
+	"strconv"
+
+	"chatgpt-adapter/core/common/document"
+	"chatgpt-adapter/core/gin/inter"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"chatgpt-adapter/core/logger"
+	"github.com/gin-gonic/gin"
+)
+
+const documentHeader = "X-Documents"
+
+// 按模型开关将 PDF / DOCX / 文本附件转换为提示词中的文本块，处理的文档数写入 X-Documents 响应头
+func prepareDocuments(gtx *gin.Context, extension inter.Adapter, completion model.Completion) (model.Completion, bool) {
+	if !document.Enabled(completion.Model, extension.Files(gtx, completion.Model)) {
+		return completion, true
+	}
+
+	messages, count, err := document.Convert(completion.Messages)
+	if err != nil {
+		logger.Error(err)
+		response.Error(gtx, http.StatusBadRequest, err)
+		return completion, false
+	}
+
+	if count > 0 {
+		gtx.Header(documentHeader, strconv.Itoa(count))
+		completion.Messages = messages
+	}
+	return completion, true
+}
@@ -0,0 +1,57 @@
+package gin
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"chatgpt-adapter/core/gin/model"
+	v1 "chatgpt-adapter/relay/llm/v1"
+	"github.com/iocgo/sdk/env"
+)
+
+func TestPrepareDocuments(t *testing.T) {
+	file := func(data string) model.Keyv[interface{}] {
+		return model.Keyv[interface{}]{"role": "user", "content": []interface{}{
+			map[string]interface{}{"type": "file", "file": map[string]interface{}{
+				"filename":  "a.txt",
+				"file_data": "data:text/plain;base64," + base64.StdEncoding.EncodeToString([]byte(data)),
+			}},
+		}}
+	}
+
+	tests := []struct {
+		name     string
+		messages []model.Keyv[interface{}]
+		ok       bool
+		header   string
+		code     int
+	}{
+		{"no documents", []model.Keyv[interface{}]{{"role": "user", "content": "hi"}}, true, "", http.StatusOK},
+		{"text document", []model.Keyv[interface{}]{file("hello")}, true, "1", http.StatusOK},
+		{"unsupported document", []model.Keyv[interface{}]{file("\x00\x01\x02")}, false, "", http.StatusBadRequest},
+	}
+
+	extension := v1.New(env.Env)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gtx, w := newTestContext()
+			completion, ok := prepareDocuments(gtx, extension, model.Completion{Model: "a/main", Messages: tt.messages})
+			if ok != tt.ok {
+				t.Fatalf("prepareDocuments() ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				if w.Code != tt.code {
+					t.Errorf("status = %d, want %d", w.Code, tt.code)
+				}
+				return
+			}
+			if header := w.Header().Get(documentHeader); header != tt.header {
+				t.Errorf("%s = %q, want %q", documentHeader, header, tt.header)
+			}
+			if tt.header != "" && completion.Messages[0].GetSlice("content")[0].(map[string]interface{})["type"] != "text" {
+				t.Errorf("messages = %v, want the document as text", completion.Messages)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package gin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/common/vars"
+	"chatgpt-adapter/core/gin/inter"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"chatgpt-adapter/core/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/iocgo/sdk/env"
+)
+
+const (
+	formatJsonObject = "json_object"
+	formatJsonSchema = "json_schema"
+)
+
+func needFormat(completion model.Completion) bool {
+	format := completion.ResponseFormat
+	return format != nil && (format.Type == formatJsonObject || format.Type == formatJsonSchema)
+}
+
+// response_format 约束：注入格式说明 -> 缓冲完整输出 -> 校验，
+// 不通过时带上错误信息重新提问，最多 server.format-retries 次（默认 2）
+func completeFormat(gtx *gin.Context, extension inter.Adapter, completion model.Completion) {
+	var (
+		format   = completion.ResponseFormat
+		stream   = completion.Stream
+		usages   = make([]map[string]interface{}, 0)
+		messages = completion.Messages
+		problems []string
+	)
+
+	if format.Type == formatJsonSchema && (format.JsonSchema == nil || format.JsonSchema.Schema == nil) {
+		response.Error(gtx, http.StatusBadRequest, "Missing required parameter: 'response_format.json_schema.schema'")
+		return
+	}
+
+	retries := env.Env.GetInt("server.format-retries")
+	if retries <= 0 {
+		retries = 2
+	}
+
+	completion.Stream = false
+	completion.ResponseFormat = nil
+	completion.Messages = append([]model.Keyv[interface{}]{
+		{"role": "system", "content": formatInstruction(format)},
+	}, messages...)
+
+	for attempt := 0; attempt <= retries; attempt++ {
+		rec := newRecorder(gtx.Writer)
+		ctx := gtx.Copy()
+		ctx.Writer = rec
+		ctx.Set(vars.GinCompletion, completion)
+		ctx.Set(vars.GinMatchers, newMatchers(ctx, completion))
+		execute(ctx, extension, completion)
+
+		var res model.Response
+		if err := json.Unmarshal(rec.buffer.Bytes(), &res); err != nil || res.Error != nil || len(res.Choices) == 0 {
+			code, e := rec.error()
+			response.Error(gtx, code, e)
+			return
+		}
+
+		usages = append(usages, res.Usage)
+		message := res.Choices[0].Message
+		if message == nil {
+			response.Error(gtx, -1, "EMPTY RESPONSE")
+			return
+		}
+
+		// 工具调用不做格式约束，原样返回
+		if len(message.ToolCalls) > 0 {
+			gtx.Set(vars.GinCompletionUsage, response.MergeUsage(usages, false))
+			respondToolCall(gtx, res, stream)
+			return
+		}
+
+		content, ok := common.ExtractJSON(message.Content)
+		if ok {
+			problems = validateFormat(format, content)
+		} else {
+			problems = []string{"the response is not valid JSON"}
+		}
+
+		if len(problems) == 0 {
+			if res.Choices[0].FinishReason != nil {
+				gtx.Set(vars.GinFinishReason, *res.Choices[0].FinishReason)
+			}
+			gtx.Set(vars.GinCompletionUsage, response.MergeUsage(usages, false))
+			response.Echo(gtx, res.Model, content, stream)
+			return
+		}
+
+		logger.Warnf("response_format validation failed, attempt %d/%d: %s", attempt+1, retries+1, strings.Join(problems, "; "))
+		completion.Messages = append(completion.Messages,
+			model.Keyv[interface{}]{"role": "assistant", "content": message.Content},
+			model.Keyv[interface{}]{"role": "user", "content": repairInstruction(problems)},
+		)
+	}
+
+	response.Error(gtx, http.StatusUnprocessableEntity, fmt.Sprintf("response_format validation failed after %d attempts: %s", retries+1, strings.Join(problems, "; ")))
+}
+
+func formatInstruction(format *model.ResponseFormat) string {
+	if format.Type == formatJsonObject {
+		return "You must respond with a single valid JSON object only. " +
+			"Do not wrap it in markdown code fences and do not add any explanation before or after it."
+	}
+
+	schema, _ := json.Marshal(format.JsonSchema.Schema)
+	instruction := "You must respond with a single valid JSON value that strictly conforms to the following JSON Schema"
+	if format.JsonSchema.Name != "" {
+		instruction += fmt.Sprintf(" (named \"%s\")", format.JsonSchema.Name)
+	}
+	instruction += ". Do not wrap it in markdown code fences and do not add any explanation before or after it."
+	if format.JsonSchema.Description != "" {
+		instruction += "\nSchema description: " + format.JsonSchema.Description
+	}
+	return instruction + "\nJSON Schema:\n" + string(schema)
+}
+
+func repairInstruction(problems []string) string {
+	return "Your previous response did not satisfy the required JSON format:\n- " +
+		strings.Join(problems, "\n- ") +
+		"\nPlease respond again with only the corrected JSON."
+}
+
+func validateFormat(format *model.ResponseFormat, content string) []string {
+	var value interface{}
+	if err := json.Unmarshal([]byte(content), &value); err != nil {
+		return []string{"the response is not valid JSON: " + err.Error()}
+	}
+
+	if format.Type == formatJsonObject {
+		if _, ok := value.(map[string]interface{}); !ok {
+			return []string{"the response must be a JSON object"}
+		}
+		return nil
+	}
+	return common.ValidateSchema(format.JsonSchema.Schema, value)
+}
+
+func respondToolCall(gtx *gin.Context, res model.Response, stream bool) {
+	if !stream {
+		res.Usage = common.GetGinCompletionUsage(gtx)
+		if env.Env.GetBool("server.no-usage") {
+			res.Usage = response.DefaultUsage
+		}
+		gtx.JSON(http.StatusOK, res)
+		return
+	}
+
+	// 并行的工具调用逐个输出，index 与 tool_calls 下标一致
+	response.SSEToolCallsResponse(gtx, res.Model, res.Choices[0].Message.ToolCalls, time.Now().Unix())
+}
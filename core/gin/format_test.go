@@ -0,0 +1,94 @@
+package gin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"chatgpt-adapter/core/gin/inter"
+	"chatgpt-adapter/core/gin/model"
+	v1 "chatgpt-adapter/relay/llm/v1"
+	"github.com/iocgo/sdk/env"
+)
+
+func TestCompleteFormat(t *testing.T) {
+	format := &model.ResponseFormat{Type: formatJsonSchema, JsonSchema: &model.JsonSchema{
+		Name: "weather",
+		Schema: map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"city": map[string]interface{}{"type": "string"}},
+			"required":   []interface{}{"city"},
+		},
+	}}
+
+	tests := []struct {
+		name     string
+		format   *model.ResponseFormat
+		replies  []string
+		code     int
+		content  string
+		requests int
+	}{
+		{"valid first", format, []string{"```json\n{\"city\":\"hz\"}\n```"}, http.StatusOK, `{"city":"hz"}`, 1},
+		{"repaired", format, []string{"sorry", `{"town":"hz"}`, `{"city":"hz"}`}, http.StatusOK, `{"city":"hz"}`, 3},
+		{"json object", &model.ResponseFormat{Type: formatJsonObject}, []string{"[1]", `{"ok":true}`}, http.StatusOK, `{"ok":true}`, 2},
+		{"retries exhausted", format, []string{"sorry"}, http.StatusUnprocessableEntity, "", 3},
+		{"missing schema", &model.ResponseFormat{Type: formatJsonSchema}, nil, http.StatusBadRequest, "", 0},
+	}
+
+	h := &Handler{[]inter.Adapter{v1.New(env.Env)}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var n atomic.Int32
+			upstreamA.reset(func(model.Completion) string {
+				i := int(n.Add(1)) - 1
+				return tt.replies[min(i, len(tt.replies)-1)]
+			})
+			defer upstreamA.reset(nil)
+
+			gtx, w := newTestContext()
+			extension, _ := h.match(gtx, "a/main")
+			completion := model.Completion{
+				Model:          "a/main",
+				Messages:       []model.Keyv[interface{}]{{"role": "user", "content": "weather in hangzhou"}},
+				ResponseFormat: tt.format,
+			}
+			completeFormat(gtx, extension, completion)
+
+			if w.Code != tt.code {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.code, w.Body.String())
+			}
+			requests := upstreamA.received()
+			if len(requests) != tt.requests {
+				t.Errorf("upstream requests = %d, want %d", len(requests), tt.requests)
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+
+			var res model.Response
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || len(res.Choices) == 0 || res.Choices[0].Message == nil {
+				t.Fatalf("response = %s", w.Body.String())
+			}
+			if content := res.Choices[0].Message.Content; content != tt.content {
+				t.Errorf("content = %q, want %q", content, tt.content)
+			}
+
+			// 格式说明作为 system 注入，重试时带上上一次的输出与错误
+			messages := requests[len(requests)-1].Messages
+			if !messages[0].Is("role", "system") || !strings.Contains(messages[0].GetString("content"), "JSON") {
+				t.Errorf("first message = %v, want the format instruction", messages[0])
+			}
+			if retries := len(requests) - 1; len(messages) != 2+retries*2 {
+				t.Errorf("messages = %d, want %d", len(messages), 2+retries*2)
+			}
+			if tt.name == "repaired" {
+				if messages[4].GetString("content") != `{"town":"hz"}` || !strings.Contains(messages[5].GetString("content"), "missing required property 'city'") {
+					t.Errorf("repair messages = %v", messages[2:])
+				}
+			}
+		})
+	}
+}
@@ -70,6 +70,7 @@ func cros(gtx *gin.Context) {
 	if gtx.Request.RequestURI == "/" ||
 		gtx.Request.RequestURI == "/favicon.ico" ||
 		strings.Contains(gtx.Request.URL.Path, "/v1/models") ||
+		gtx.Request.URL.Path == "/metrics" ||
 		strings.HasPrefix(gtx.Request.URL.Path, "/file/") {
 		// 处理请求
 		gtx.Next()
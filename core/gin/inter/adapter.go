@@ -13,6 +13,10 @@ type Adapter interface {
 	Embedding(ctx *gin.Context) error
 	ToolChoice(ctx *gin.Context) (bool, error)
 	HandleMessages(ctx *gin.Context, completion model.Completion) (messages []model.Keyv[interface{}], err error)
+	// 是否支持 image_url 图片输入，不支持时由 vision.fallback 决定拒绝或降级
+	Vision(ctx *gin.Context, model string) bool
+	// 是否原生处理 file 类型的文档附件，不支持时由 document 配置决定是否提取为文本
+	Files(ctx *gin.Context, model string) bool
 }
 
 type BaseAdapter struct{}
@@ -22,6 +26,8 @@ func (BaseAdapter) Completion(*gin.Context) (err error)          { return }
 func (BaseAdapter) Generation(*gin.Context) (err error)          { return }
 func (BaseAdapter) Embedding(*gin.Context) (err error)           { return }
 func (BaseAdapter) ToolChoice(*gin.Context) (ok bool, err error) { return }
+func (BaseAdapter) Vision(*gin.Context, string) (ok bool)        { return }
+func (BaseAdapter) Files(*gin.Context, string) (ok bool)         { return }
 func (BaseAdapter) HandleMessages(ctx *gin.Context, completion model.Completion) (messages []model.Keyv[interface{}], err error) {
 	messages = completion.Messages
 	return
@@ -0,0 +1,138 @@
+package gin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/core/common/mcp"
+	"chatgpt-adapter/core/gin/model"
+	"github.com/gin-gonic/gin"
+	"github.com/iocgo/sdk/env"
+)
+
+// custom-llm 的上游，前缀分别为 a、b，t 开启工具调用模拟
+var upstreamA, upstreamB, upstreamT *upstream
+
+// 模拟 openai 兼容的上游，记录收到的请求并按 reply 返回流式内容
+type upstream struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []model.Completion
+	reply    func(completion model.Completion) string
+	def      func(completion model.Completion) string
+}
+
+func newUpstream(reply string) *upstream {
+	def := func(model.Completion) string { return reply }
+	up := &upstream{reply: def, def: def}
+	up.Server = httptest.NewServer(http.HandlerFunc(up.serve))
+	return up
+}
+
+func (up *upstream) serve(w http.ResponseWriter, r *http.Request) {
+	var completion model.Completion
+	if err := json.NewDecoder(r.Body).Decode(&completion); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	up.mu.Lock()
+	up.requests = append(up.requests, completion)
+	reply := up.reply
+	up.mu.Unlock()
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"object": "chat.completion.chunk",
+		"model":  completion.Model,
+		"choices": []interface{}{
+			map[string]interface{}{"index": 0, "delta": map[string]interface{}{"role": "assistant", "content": reply(completion)}},
+		},
+	})
+	w.Header().Set("Content-Type", "text/event-stream")
+	_, _ = fmt.Fprintf(w, "data: %s\n\ndata: [DONE]\n\n", data)
+}
+
+// 重置记录的请求，并设置新的返回内容，reply 为空时恢复默认
+func (up *upstream) reset(reply func(completion model.Completion) string) {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	up.requests = nil
+	up.reply = up.def
+	if reply != nil {
+		up.reply = reply
+	}
+}
+
+func (up *upstream) received() []model.Completion {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	return append([]model.Completion(nil), up.requests...)
+}
+
+func TestMain(m *testing.M) {
+	// 作为 stdio MCP 服务启动的子进程
+	if len(os.Args) > 1 && os.Args[1] == mcpStubArg {
+		serveMCPStub()
+		return
+	}
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	gin.SetMode(gin.TestMode)
+	upstreamA, upstreamB, upstreamT = newUpstream("main"), newUpstream("summary"), newUpstream("")
+	defer upstreamA.Close()
+	defer upstreamB.Close()
+	defer upstreamT.Close()
+
+	dir, err := os.MkdirTemp("", "chatgpt-adapter")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	defer mcp.Close()
+
+	config := fmt.Sprintf(`
+server:
+  no-usage: true
+pricing:
+  dir: ""
+response-cache:
+  enabled: true
+metrics:
+  token: metrics-secret
+custom-llm:
+  - prefix: a
+    reversal: %s
+  - prefix: b
+    reversal: %s
+  - prefix: t
+    reversal: %s
+    tc: "true"
+mcp:
+  servers:
+    - name: stub
+      command: %s
+      args: [ %s ]
+`, upstreamA.URL, upstreamB.URL, upstreamT.URL, os.Args[0], mcpStubArg)
+	path := filepath.Join(dir, "config.yaml")
+	if err = os.WriteFile(path, []byte(config), 0644); err != nil {
+		panic(err)
+	}
+
+	_ = os.Setenv("CONFIG_PATH", path)
+	environment, err := env.New()
+	if err != nil {
+		panic(err)
+	}
+	inited.Initialized(environment)
+	return m.Run()
+}
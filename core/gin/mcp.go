@@ -0,0 +1,142 @@
+package gin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/common/mcp"
+	"chatgpt-adapter/core/common/toolcall"
+	"chatgpt-adapter/core/common/vars"
+	"chatgpt-adapter/core/gin/inter"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"chatgpt-adapter/core/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// 只在请求携带 tools 或模型配置在 mcp.models 中时走服务端工具循环
+func needMCP(completion model.Completion) bool {
+	if !mcp.Enabled() {
+		return false
+	}
+	if len(completion.Tools) == 0 && !mcp.Always(completion.Model) {
+		return false
+	}
+	mode, _ := toolcall.ParseToolChoice(completion.ToolChoice)
+	return mode != toolcall.ChoiceNone
+}
+
+// 服务端执行 MCP 工具：合并工具定义 -> 缓冲完整输出 -> 命中 MCP 工具则执行并追加结果继续，
+// 最多 mcp.max-iterations 轮，只把最终回答返回给客户端；调用客户端自己的工具时原样返回
+func completeMCP(gtx *gin.Context, extension inter.Adapter, completion model.Completion) {
+	var (
+		stream = completion.Stream
+		usages = make([]map[string]interface{}, 0)
+		limit  = mcp.MaxIterations()
+	)
+
+	exists := make(map[string]bool)
+	for _, tool := range completion.Tools {
+		exists[tool.GetKeyv("function").GetString("name")] = true
+	}
+	for _, tool := range mcp.Tools() {
+		if !exists[tool.GetKeyv("function").GetString("name")] {
+			completion.Tools = append(completion.Tools, tool)
+		}
+	}
+
+	// MCP 工具依赖工具调用模拟，未开启时按默认方式开启；每轮拿到工具结果后继续判断是否调用工具
+	t := common.GetGinToolValue(gtx)
+	gtx.Set(vars.GinTool, model.Keyv[interface{}]{
+		"id":      t.GetString("id"),
+		"enabled": true,
+		"tasks":   t.Is("enabled", true) && t.Is("tasks", true),
+		"loop":    true,
+	})
+
+	completion.Stream = false
+	for iteration := 0; ; iteration++ {
+		// 达到上限后禁止继续调用工具，要求直接回答
+		if iteration >= limit {
+			completion.ToolChoice = toolcall.ChoiceNone
+		}
+
+		rec := newRecorder(gtx.Writer)
+		ctx := gtx.Copy()
+		ctx.Writer = rec
+		ctx.Set(vars.GinCompletion, completion)
+		ctx.Set(vars.GinMatchers, newMatchers(ctx, completion))
+		execute(ctx, extension, completion)
+
+		var res model.Response
+		if err := json.Unmarshal(rec.buffer.Bytes(), &res); err != nil || res.Error != nil || len(res.Choices) == 0 {
+			code, e := rec.error()
+			response.Error(gtx, code, e)
+			return
+		}
+
+		usages = append(usages, res.Usage)
+		message := res.Choices[0].Message
+		if message == nil {
+			response.Error(gtx, -1, "EMPTY RESPONSE")
+			return
+		}
+
+		if len(message.ToolCalls) == 0 {
+			if res.Choices[0].FinishReason != nil {
+				gtx.Set(vars.GinFinishReason, *res.Choices[0].FinishReason)
+			}
+			gtx.Set(vars.GinCompletionUsage, response.MergeUsage(usages, false))
+			response.Echo(gtx, res.Model, message.Content, stream)
+			return
+		}
+
+		for _, call := range message.ToolCalls {
+			if !mcp.Has(call.GetKeyv("function").GetString("name")) {
+				gtx.Set(vars.GinCompletionUsage, response.MergeUsage(usages, false))
+				respondToolCall(gtx, res, stream)
+				return
+			}
+		}
+
+		if iteration >= limit {
+			response.Error(gtx, http.StatusInternalServerError, fmt.Sprintf("mcp tool loop exceeded the maximum of %d iterations", limit))
+			return
+		}
+
+		calls := make([]interface{}, 0, len(message.ToolCalls))
+		results := make([]model.Keyv[interface{}], 0, len(message.ToolCalls))
+		for i, call := range message.ToolCalls {
+			id := call.GetString("id")
+			if id == "" {
+				id = fmt.Sprintf("call_%d_%d", iteration, i)
+				call["id"] = id
+			}
+
+			fn := call.GetKeyv("function")
+			name := fn.GetString("name")
+			content, err := mcp.Call(gtx.Request.Context(), name, fn.GetString("arguments"))
+			if err != nil {
+				logger.Errorf("mcp tool '%s' call failed: %v", name, err)
+				content = "Error: " + err.Error()
+			}
+
+			calls = append(calls, map[string]interface{}(call))
+			results = append(results, model.Keyv[interface{}]{
+				"role":         "tool",
+				"tool_call_id": id,
+				"name":         name,
+				"content":      content,
+			})
+		}
+
+		completion.Messages = append(completion.Messages, model.Keyv[interface{}]{
+			"role":       "assistant",
+			"content":    message.Content,
+			"tool_calls": calls,
+		})
+		completion.Messages = append(completion.Messages, results...)
+	}
+}
@@ -0,0 +1,122 @@
+package gin
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"chatgpt-adapter/core/gin/inter"
+	"chatgpt-adapter/core/gin/model"
+	v1 "chatgpt-adapter/relay/llm/v1"
+	"github.com/iocgo/sdk/env"
+)
+
+const mcpStubArg = "mcp-stub"
+
+// 提供 add 与 upper 两个工具的 stdio MCP 服务
+func serveMCPStub() {
+	scanner := bufio.NewScanner(os.Stdin)
+	encoder := json.NewEncoder(os.Stdout)
+	for scanner.Scan() {
+		var req struct {
+			Id     *int64 `json:"id"`
+			Method string `json:"method"`
+			Params struct {
+				Name      string                 `json:"name"`
+				Arguments map[string]interface{} `json:"arguments"`
+			} `json:"params"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &req) != nil || req.Id == nil {
+			continue
+		}
+
+		var result interface{}
+		switch req.Method {
+		case "initialize":
+			result = map[string]interface{}{"protocolVersion": "2024-11-05", "capabilities": map[string]interface{}{}}
+		case "tools/list":
+			result = map[string]interface{}{"tools": []interface{}{
+				map[string]interface{}{"name": "add", "description": "add two numbers", "inputSchema": map[string]interface{}{
+					"type":       "object",
+					"properties": map[string]interface{}{"a": map[string]interface{}{"type": "number"}, "b": map[string]interface{}{"type": "number"}},
+					"required":   []interface{}{"a", "b"},
+				}},
+				map[string]interface{}{"name": "upper", "description": "upper case a text", "inputSchema": map[string]interface{}{
+					"type":       "object",
+					"properties": map[string]interface{}{"text": map[string]interface{}{"type": "string"}},
+					"required":   []interface{}{"text"},
+				}},
+			}}
+		case "tools/call":
+			var text string
+			switch args := req.Params.Arguments; req.Params.Name {
+			case "add":
+				text = fmt.Sprint(args["a"].(float64) + args["b"].(float64))
+			default:
+				text = strings.ToUpper(fmt.Sprint(args["text"]))
+			}
+			result = map[string]interface{}{"content": []interface{}{map[string]interface{}{"type": "text", "text": text}}}
+		}
+		_ = encoder.Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.Id, "result": result})
+	}
+}
+
+// 工具结果返回后继续判断是否调用工具，直到模型不再调用时给出最终回答
+func TestCompleteMCPLoop(t *testing.T) {
+	var emulated atomic.Int32
+	upstreamT.reset(func(completion model.Completion) string {
+		// 工具调用模拟的请求只有一条拼接后的提示词
+		if len(completion.Messages) == 1 {
+			switch emulated.Add(1) {
+			case 1:
+				return `{"toolId":"add","arguments":{"a":1,"b":2}}`
+			case 2:
+				return `{"toolId":"upper","arguments":{"text":"sum is 3"}}`
+			}
+			return "no tool is needed"
+		}
+		messages := completion.Messages
+		return "answer: " + messages[len(messages)-1].GetString("content")
+	})
+
+	h := &Handler{[]inter.Adapter{v1.New(env.Env)}}
+	gtx, w := newTestContext()
+	extension, ok := h.match(gtx, "t/loop")
+	if !ok {
+		t.Fatal("model 't/loop' is not matched")
+	}
+
+	completion := model.Completion{
+		Model:    "t/loop",
+		Messages: []model.Keyv[interface{}]{{"role": "user", "content": "add 1 and 2, then shout the result"}},
+		Tools: []model.Keyv[interface{}]{{"type": "function", "function": map[string]interface{}{
+			"name":       "weather",
+			"parameters": map[string]interface{}{"type": "object", "properties": map[string]interface{}{}},
+		}}},
+	}
+	if !needMCP(completion) {
+		t.Fatal("needMCP() = false")
+	}
+	completeMCP(gtx, extension, completion)
+
+	var res model.Response
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || len(res.Choices) == 0 || res.Choices[0].Message == nil {
+		t.Fatalf("response = %s", w.Body.String())
+	}
+	if content := res.Choices[0].Message.Content; content != "answer: SUM IS 3" {
+		t.Errorf("final answer = %q, want %q", content, "answer: SUM IS 3")
+	}
+	if n := emulated.Load(); n != 3 {
+		t.Errorf("tool choice asked %d times, want 3", n)
+	}
+
+	requests := upstreamT.received()
+	last := requests[len(requests)-1].Messages
+	if roles := len(last); roles != 5 || last[2].GetString("content") != "3" || last[4].GetString("content") != "SUM IS 3" {
+		t.Errorf("final request messages = %v", last)
+	}
+}
@@ -8,17 +8,45 @@ type Model struct {
 }
 
 type Completion struct {
-	System        string              `json:"system,omitempty"`
-	Messages      []Keyv[interface{}] `json:"messages"`
-	Tools         []Keyv[interface{}] `json:"tools,omitempty"`
-	Model         string              `json:"model,omitempty"`
-	MaxTokens     int                 `json:"max_tokens"`
-	StopSequences []string            `json:"stop,omitempty"`
-	Temperature   float32             `json:"temperature"`
-	TopK          int                 `json:"top_k,omitempty"`
-	TopP          float32             `json:"top_p,omitempty"`
-	Stream        bool                `json:"stream,omitempty"`
-	ToolChoice    interface{}         `json:"tool_choice,omitempty"`
+	System         string              `json:"system,omitempty"`
+	Messages       []Keyv[interface{}] `json:"messages"`
+	Tools          []Keyv[interface{}] `json:"tools,omitempty"`
+	Model          string              `json:"model,omitempty"`
+	MaxTokens      int                 `json:"max_tokens"`
+	StopSequences  []string            `json:"stop,omitempty"`
+	Temperature    *float32            `json:"temperature,omitempty"`
+	TopK           int                 `json:"top_k,omitempty"`
+	TopP           float32             `json:"top_p,omitempty"`
+	N              int                 `json:"n,omitempty"`
+	Stream         bool                `json:"stream,omitempty"`
+	StreamOptions  *StreamOptions      `json:"stream_options,omitempty"`
+	ToolChoice     interface{}         `json:"tool_choice,omitempty"`
+	ResponseFormat *ResponseFormat     `json:"response_format,omitempty"`
+	ConversationId string              `json:"conversation_id,omitempty"`
+}
+
+// 客户端未传 temperature 时返回 def
+func (c Completion) GetTemperature(def float32) float32 {
+	if c.Temperature == nil {
+		return def
+	}
+	return *c.Temperature
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type ResponseFormat struct {
+	Type       string      `json:"type"`
+	JsonSchema *JsonSchema `json:"json_schema,omitempty"`
+}
+
+type JsonSchema struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Schema      map[string]interface{} `json:"schema,omitempty"`
+	Strict      bool                   `json:"strict,omitempty"`
 }
 
 type Generation struct {
@@ -17,9 +17,11 @@ import (
 )
 
 var (
-	stop        = "stop"
-	toolCalls   = "tool_calls"
-	canResponse = "__can-response__"
+	stop          = "stop"
+	length        = "length"
+	contentFilter = "content_filter"
+	toolCalls     = "tool_calls"
+	canResponse   = "__can-response__"
 
 	EOF = "<CHAR_trun>"
 
@@ -61,6 +63,25 @@ func MessageValidator(ctx *gin.Context) bool {
 	return true
 }
 
+// 将上游的结束原因转换为 OpenAI 规范值：stop | length | content_filter | tool_calls
+func FinishReason(reason string) string {
+	switch strings.ToLower(strings.TrimSpace(reason)) {
+	case "length", "max_tokens", "max_length", "token_limit":
+		return length
+	case "content_filter", "content_filtered", "sensitive", "safety", "blocked", "recitation":
+		return contentFilter
+	case "tool_calls", "tool_use", "function_call":
+		return toolCalls
+	default:
+		return stop
+	}
+}
+
+// 记录本次响应的结束原因，由 Response / SSEResponse 输出
+func SetFinishReason(ctx *gin.Context, reason string) {
+	ctx.Set(vars.GinFinishReason, FinishReason(reason))
+}
+
 func Error(ctx *gin.Context, code int, err interface{}) {
 	ctx.Set(canResponse, "No!")
 	if code == -1 {
@@ -100,6 +121,7 @@ func Response(ctx *gin.Context, mod, content string) {
 		usage = DefaultUsage
 	}
 
+	finishReason := common.GetGinFinishReason(ctx)
 	ctx.JSON(http.StatusOK, model.Response{
 		Model:   mod,
 		Created: created,
@@ -113,7 +135,7 @@ func Response(ctx *gin.Context, mod, content string) {
 					Content   string                    `json:"content,omitempty"`
 					ToolCalls []model.Keyv[interface{}] `json:"tool_calls,omitempty"`
 				}{"assistant", content, nil},
-				FinishReason: &stop,
+				FinishReason: &finishReason,
 			},
 		},
 		Usage: usage,
@@ -156,15 +178,10 @@ func SSEResponse(ctx *gin.Context, mod, content string, created int64) {
 
 	done := false
 	finishReason := ""
-	usage := common.GetGinCompletionUsage(ctx)
-	if env.Env.GetBool("server.no-usage") {
-		usage = DefaultUsage
-	}
-
 	if content == "[DONE]" {
 		done = true
 		content = ""
-		finishReason = "stop"
+		finishReason = common.GetGinFinishReason(ctx)
 	}
 
 	for _, char := range []rune(content) {
@@ -186,7 +203,7 @@ func SSEResponse(ctx *gin.Context, mod, content string, created int64) {
 			},
 		}
 
-		Event(ctx, "", response)
+		SSEChunk(ctx, response)
 	}
 
 	if done {
@@ -207,9 +224,9 @@ func SSEResponse(ctx *gin.Context, mod, content string, created int64) {
 				},
 			},
 		}
-		response.Usage = usage
 		response.Choices[0].FinishReason = &finishReason
-		Event(ctx, "", response)
+		SSEChunk(ctx, response)
+		SSEUsage(ctx, mod, created)
 		Event(ctx, "", "[DONE]")
 	}
 }
@@ -244,7 +261,36 @@ func ToolCallResponse(ctx *gin.Context, mod, name, args string) {
 						},
 					},
 				},
-				FinishReason: &stop,
+				FinishReason: &toolCalls,
+			},
+		},
+		Usage: usage,
+	})
+}
+
+// 原生工具调用：一次返回多个 tool_calls，content 可同时存在
+func ToolCallsResponse(ctx *gin.Context, mod, content string, calls []model.Keyv[interface{}]) {
+	ctx.Set(canResponse, "No!")
+	created := time.Now().Unix()
+	usage := common.GetGinCompletionUsage(ctx)
+	if env.Env.GetBool("server.no-usage") {
+		usage = DefaultUsage
+	}
+
+	ctx.JSON(http.StatusOK, model.Response{
+		Model:   mod,
+		Created: created,
+		Id:      fmt.Sprintf("chatcmpl-%d", created),
+		Object:  "chat.completion",
+		Choices: []model.Choice{
+			{
+				Index: 0,
+				Message: &struct {
+					Role      string                    `json:"role,omitempty"`
+					Content   string                    `json:"content,omitempty"`
+					ToolCalls []model.Keyv[interface{}] `json:"tool_calls,omitempty"`
+				}{"assistant", content, calls},
+				FinishReason: &toolCalls,
 			},
 		},
 		Usage: usage,
@@ -254,7 +300,6 @@ func ToolCallResponse(ctx *gin.Context, mod, name, args string) {
 func SSEToolCallResponse(ctx *gin.Context, mod, name, args string, created int64) {
 	ctx.Set(canResponse, "No!")
 	setSSEHeader(ctx)
-	usage := common.GetGinCompletionUsage(ctx)
 
 	response := model.Response{
 		Model:   mod,
@@ -281,23 +326,108 @@ func SSEToolCallResponse(ctx *gin.Context, mod, name, args string, created int64
 		ToolCalls: []model.Keyv[interface{}]{toolCall},
 	}
 
-	Event(ctx, "", response)
+	SSEChunk(ctx, response)
 
 	delete(toolCall, "id")
 	delete(toolCall, "type")
 	toolCall["function"] = map[string]string{"arguments": args}
 	response.Choices[0].Delta.ToolCalls[0] = toolCall
 	response.Choices[0].Delta.Role = ""
-	Event(ctx, "", response)
+	SSEChunk(ctx, response)
 
 	response.Choices[0].FinishReason = &toolCalls
 	response.Choices[0].Delta = nil
-	response.Usage = usage
-	Event(ctx, "", response)
+	SSEChunk(ctx, response)
+	SSEUsage(ctx, mod, created)
 
 	Event(ctx, "", "[DONE]")
 }
 
+// 原生工具调用的流式输出：每个工具调用一个数据块，index 与 tool_calls 下标一致
+func SSEToolCallsResponse(ctx *gin.Context, mod string, calls []model.Keyv[interface{}], created int64) {
+	ctx.Set(canResponse, "No!")
+	setSSEHeader(ctx)
+
+	response := model.Response{
+		Model:   mod,
+		Created: created,
+		Id:      fmt.Sprintf("chatcmpl-%d", created),
+		Object:  "chat.completion.chunk",
+		Choices: []model.Choice{
+			{Index: 0},
+		},
+	}
+
+	for index, call := range calls {
+		toolCall := call.Clone()
+		toolCall["index"] = index
+		role := ""
+		if index == 0 {
+			role = "assistant"
+		}
+
+		response.Choices[0].Delta = &struct {
+			Type      string                    `json:"type,omitempty"`
+			Role      string                    `json:"role,omitempty"`
+			Content   string                    `json:"content,omitempty"`
+			ToolCalls []model.Keyv[interface{}] `json:"tool_calls,omitempty"`
+		}{
+			Role:      role,
+			ToolCalls: []model.Keyv[interface{}]{toolCall},
+		}
+		SSEChunk(ctx, response)
+	}
+
+	response.Choices[0].FinishReason = &toolCalls
+	response.Choices[0].Delta = nil
+	SSEChunk(ctx, response)
+	SSEUsage(ctx, mod, created)
+
+	Event(ctx, "", "[DONE]")
+}
+
+// include_usage 开启时，普通数据块需要输出 "usage": null
+type usageChunk struct {
+	model.Response
+	Usage map[string]interface{} `json:"usage"`
+}
+
+// 输出流式数据块，usage 遵循 stream_options.include_usage 约定：
+// 开启时每个数据块携带 "usage": null，未开启时不输出 usage
+func SSEChunk(ctx *gin.Context, response model.Response) {
+	response.Usage = nil
+	if !IncludeUsage(ctx) {
+		Event(ctx, "", response)
+		return
+	}
+	Event(ctx, "", usageChunk{response, nil})
+}
+
+// 在 [DONE] 之前追加 choices 为空的用量块，仅 stream_options.include_usage 开启时输出
+func SSEUsage(ctx *gin.Context, mod string, created int64) {
+	if !IncludeUsage(ctx) {
+		return
+	}
+
+	usage := common.GetGinCompletionUsage(ctx)
+	if usage == nil || env.Env.GetBool("server.no-usage") {
+		usage = DefaultUsage
+	}
+
+	Event(ctx, "", usageChunk{model.Response{
+		Model:   mod,
+		Created: created,
+		Id:      fmt.Sprintf("chatcmpl-%d", created),
+		Object:  "chat.completion.chunk",
+		Choices: make([]model.Choice, 0),
+	}, usage})
+}
+
+func IncludeUsage(ctx *gin.Context) bool {
+	completion := common.GetGinCompletion(ctx)
+	return completion.StreamOptions != nil && completion.StreamOptions.IncludeUsage
+}
+
 func NotResponse(ctx *gin.Context) bool {
 	return ctx.GetString(canResponse) == "" && NotSSEHeader(ctx)
 }
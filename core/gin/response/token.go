@@ -1,29 +1,155 @@
 package response
 
 import (
-	"chatgpt-adapter/core/logger"
-	encoder "github.com/samber/go-gpt-3-encoder"
+	"chatgpt-adapter/core/common/tokenizer"
 )
 
-func CalcTokens(content string) int {
-	resolver, err := encoder.NewEncoder()
-	if err != nil {
-		logger.Error(err)
-		return 0
-	}
-	result, err := resolver.Encode(content)
-	if err != nil {
-		logger.Error(err)
-		return 0
-	}
-	return len(result)
+// 按模型选择分词器计算 token 数
+func CalcTokens(model, content string) int {
+	return tokenizer.Count(model, content)
 }
 
-func CalcUsageTokens(content string, previousTokens int) map[string]interface{} {
-	tokens := CalcTokens(content)
+// 本地估算的用量，estimated 标记为 true
+func CalcUsageTokens(model, content string, previousTokens int) map[string]interface{} {
+	tokens := CalcTokens(model, content)
 	return map[string]interface{}{
 		"completion_tokens": tokens,
 		"prompt_tokens":     previousTokens,
 		"total_tokens":      previousTokens + tokens,
+		"estimated":         true,
+	}
+}
+
+// 优先使用上游返回的用量，缺失时本地估算
+func ResolveUsage(model string, upstream map[string]interface{}, content string, previousTokens int) map[string]interface{} {
+	if usage := NormalizeUsage(upstream); usage != nil {
+		return usage
+	}
+	return CalcUsageTokens(model, content, previousTokens)
+}
+
+// 将上游用量统一为 OpenAI 格式，保留缓存与推理的细分：
+//
+//	OpenAI:    prompt_tokens / completion_tokens / prompt_tokens_details.cached_tokens / completion_tokens_details.reasoning_tokens
+//	Anthropic: input_tokens / output_tokens / cache_read_input_tokens / cache_creation_input_tokens
+//	DeepSeek:  prompt_cache_hit_tokens
+//
+// 无法识别时返回 nil
+func NormalizeUsage(upstream map[string]interface{}) map[string]interface{} {
+	if upstream == nil {
+		return nil
+	}
+
+	_, isOpenAI := upstream["prompt_tokens"]
+	_, isAnthropic := upstream["input_tokens"]
+	if !isOpenAI && !isAnthropic {
+		return nil
+	}
+
+	var (
+		prompt, completion, cached, reasoning int
+
+		details           = mapOf(upstream["prompt_tokens_details"])
+		completionDetails = mapOf(upstream["completion_tokens_details"])
+	)
+
+	if isOpenAI {
+		prompt = intOf(upstream["prompt_tokens"])
+		completion = intOf(upstream["completion_tokens"])
+		cached = intOf(details["cached_tokens"])
+		if cached == 0 {
+			cached = intOf(upstream["prompt_cache_hit_tokens"])
+		}
+	} else {
+		// Anthropic 的 input_tokens 不包含缓存部分
+		cached = intOf(upstream["cache_read_input_tokens"])
+		prompt = intOf(upstream["input_tokens"]) + cached + intOf(upstream["cache_creation_input_tokens"])
+		completion = intOf(upstream["output_tokens"])
+	}
+	reasoning = intOf(completionDetails["reasoning_tokens"])
+
+	usage := map[string]interface{}{
+		"completion_tokens": completion,
+		"prompt_tokens":     prompt,
+		"total_tokens":      prompt + completion,
+		"estimated":         false,
+	}
+	if cached > 0 {
+		usage["prompt_tokens_details"] = map[string]interface{}{"cached_tokens": cached}
+	}
+	if reasoning > 0 {
+		usage["completion_tokens_details"] = map[string]interface{}{"reasoning_tokens": reasoning}
+	}
+	return usage
+}
+
+// 合并多次请求的用量；samePrompt 为 true 时提示词只计一次（n > 1 的多个 choice）
+func MergeUsage(usages []map[string]interface{}, samePrompt bool) map[string]interface{} {
+	var (
+		prompt, completion, cached, reasoning int
+
+		estimated = false
+	)
+
+	for _, usage := range usages {
+		if usage == nil {
+			continue
+		}
+		if !samePrompt || prompt == 0 {
+			prompt += intOf(usage["prompt_tokens"])
+			cached += intOf(mapOf(usage["prompt_tokens_details"])["cached_tokens"])
+		}
+		completion += intOf(usage["completion_tokens"])
+		reasoning += intOf(mapOf(usage["completion_tokens_details"])["reasoning_tokens"])
+
+		// 任意一次为估算值时整体视为估算
+		if value, _ := usage["estimated"].(bool); value {
+			estimated = true
+		}
+	}
+
+	result := map[string]interface{}{
+		"completion_tokens": completion,
+		"prompt_tokens":     prompt,
+		"total_tokens":      prompt + completion,
+		"estimated":         estimated,
+	}
+	if cached > 0 {
+		result["prompt_tokens_details"] = map[string]interface{}{"cached_tokens": cached}
+	}
+	if reasoning > 0 {
+		result["completion_tokens_details"] = map[string]interface{}{"reasoning_tokens": reasoning}
+	}
+	return result
+}
+
+// 从用量中读取各项 token 数
+func UsageTokens(usage map[string]interface{}) (prompt, completion, cached int, estimated bool) {
+	prompt = intOf(usage["prompt_tokens"])
+	completion = intOf(usage["completion_tokens"])
+	cached = intOf(mapOf(usage["prompt_tokens_details"])["cached_tokens"])
+	estimated, _ = usage["estimated"].(bool)
+	return
+}
+
+func mapOf(value interface{}) map[string]interface{} {
+	m, _ := value.(map[string]interface{})
+	return m
+}
+
+func intOf(value interface{}) int {
+	switch v := value.(type) {
+	case int:
+		return v
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	case float32:
+		return int(v)
+	default:
+		return 0
 	}
 }
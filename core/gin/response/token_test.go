@@ -0,0 +1,150 @@
+package response
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeUsage(t *testing.T) {
+	tests := []struct {
+		name     string
+		upstream map[string]interface{}
+		want     map[string]interface{}
+	}{
+		{"nil", nil, nil},
+		{"unknown format", map[string]interface{}{"tokens": 10.0}, nil},
+		{
+			"openai",
+			map[string]interface{}{"prompt_tokens": 10.0, "completion_tokens": 5.0, "total_tokens": 15.0},
+			map[string]interface{}{"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15, "estimated": false},
+		},
+		{
+			"openai details",
+			map[string]interface{}{
+				"prompt_tokens":             100.0,
+				"completion_tokens":         50.0,
+				"prompt_tokens_details":     map[string]interface{}{"cached_tokens": 40.0},
+				"completion_tokens_details": map[string]interface{}{"reasoning_tokens": 30.0},
+			},
+			map[string]interface{}{
+				"prompt_tokens":             100,
+				"completion_tokens":         50,
+				"total_tokens":              150,
+				"estimated":                 false,
+				"prompt_tokens_details":     map[string]interface{}{"cached_tokens": 40},
+				"completion_tokens_details": map[string]interface{}{"reasoning_tokens": 30},
+			},
+		},
+		{
+			"deepseek cache hit",
+			map[string]interface{}{"prompt_tokens": 100.0, "completion_tokens": 20.0, "prompt_cache_hit_tokens": 64.0},
+			map[string]interface{}{
+				"prompt_tokens":         100,
+				"completion_tokens":     20,
+				"total_tokens":          120,
+				"estimated":             false,
+				"prompt_tokens_details": map[string]interface{}{"cached_tokens": 64},
+			},
+		},
+		{
+			"anthropic",
+			map[string]interface{}{
+				"input_tokens":                10.0,
+				"output_tokens":               5.0,
+				"cache_read_input_tokens":     20.0,
+				"cache_creation_input_tokens": 30.0,
+			},
+			map[string]interface{}{
+				"prompt_tokens":         60,
+				"completion_tokens":     5,
+				"total_tokens":          65,
+				"estimated":             false,
+				"prompt_tokens_details": map[string]interface{}{"cached_tokens": 20},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeUsage(tt.upstream); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NormalizeUsage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeUsage(t *testing.T) {
+	first := map[string]interface{}{
+		"prompt_tokens":             100,
+		"completion_tokens":         10,
+		"estimated":                 false,
+		"prompt_tokens_details":     map[string]interface{}{"cached_tokens": 40},
+		"completion_tokens_details": map[string]interface{}{"reasoning_tokens": 4},
+	}
+	second := map[string]interface{}{
+		"prompt_tokens":     100.0,
+		"completion_tokens": 20.0,
+		"estimated":         true,
+	}
+
+	tests := []struct {
+		name       string
+		usages     []map[string]interface{}
+		samePrompt bool
+		want       map[string]interface{}
+	}{
+		{
+			"empty",
+			nil,
+			false,
+			map[string]interface{}{"prompt_tokens": 0, "completion_tokens": 0, "total_tokens": 0, "estimated": false},
+		},
+		{
+			"same prompt counted once",
+			[]map[string]interface{}{first, nil, second},
+			true,
+			map[string]interface{}{
+				"prompt_tokens":             100,
+				"completion_tokens":         30,
+				"total_tokens":              130,
+				"estimated":                 true,
+				"prompt_tokens_details":     map[string]interface{}{"cached_tokens": 40},
+				"completion_tokens_details": map[string]interface{}{"reasoning_tokens": 4},
+			},
+		},
+		{
+			"separate prompts summed",
+			[]map[string]interface{}{first, second},
+			false,
+			map[string]interface{}{
+				"prompt_tokens":             200,
+				"completion_tokens":         30,
+				"total_tokens":              230,
+				"estimated":                 true,
+				"prompt_tokens_details":     map[string]interface{}{"cached_tokens": 40},
+				"completion_tokens_details": map[string]interface{}{"reasoning_tokens": 4},
+			},
+		},
+		{
+			"upstream only",
+			[]map[string]interface{}{first},
+			true,
+			map[string]interface{}{
+				"prompt_tokens":             100,
+				"completion_tokens":         10,
+				"total_tokens":              110,
+				"estimated":                 false,
+				"prompt_tokens_details":     map[string]interface{}{"cached_tokens": 40},
+				"completion_tokens_details": map[string]interface{}{"reasoning_tokens": 4},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MergeUsage(tt.usages, tt.samePrompt); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MergeUsage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,8 +1,13 @@
 package gin
 
 import (
+	"chatgpt-adapter/core/common/conversation"
+	"chatgpt-adapter/core/common/pricing"
+	"chatgpt-adapter/core/common/tokenizer"
 	"chatgpt-adapter/core/common/toolcall"
+	"chatgpt-adapter/core/common/window"
 	"fmt"
+	"net/http"
 	"time"
 
 	"chatgpt-adapter/core/common/vars"
@@ -12,6 +17,8 @@ import (
 	"chatgpt-adapter/core/logger"
 	"github.com/gin-gonic/gin"
 	"github.com/iocgo/sdk"
+	"github.com/iocgo/sdk/env"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // @Router()
@@ -43,54 +50,130 @@ func (h *Handler) completions(gtx *gin.Context) {
 		return
 	}
 
+	completion, messages, ok := mergeConversation(gtx, completion)
+	if !ok {
+		return
+	}
+
+	completion.Model = toolcall.ApplyMode(gtx, completion.Model)
+	extension, ok := h.match(gtx, completion.Model)
+	if !ok {
+		return
+	}
+
+	// 先转换文档附件，上下文窗口按转换后的文本计算
+	if completion, ok = prepareDocuments(gtx, extension, completion); !ok {
+		return
+	}
+
+	completion = h.applyWindow(gtx, completion)
 	gtx.Set(vars.GinCompletion, completion)
 	logger.Infof("curr model: %s", completion.Model)
-	gtx.Set(vars.GinMatchers, response.NewMatchers(gtx, func(str string) {
-		if completion.Stream {
-			response.SSEResponse(gtx, "matcher", str, time.Now().Unix())
-		}
-	}))
+	gtx.Set(vars.GinMatchers, newMatchers(gtx, completion))
 
 	if !response.MessageValidator(gtx) {
 		return
 	}
 
+	if completion.N > maxChoices {
+		response.Error(gtx, http.StatusBadRequest, fmt.Sprintf("%d is greater than the maximum of %d - 'n'", completion.N, maxChoices))
+		return
+	}
+
+	if completion, ok = prepareVision(gtx, extension, completion); !ok {
+		return
+	}
+
+	if completion.ConversationId != "" {
+		completeConversation(gtx, completion, messages, func(ctx *gin.Context) {
+			dispatch(ctx, extension, completion)
+		})
+		return
+	}
+
+	dispatch(gtx, extension, completion)
+}
+
+// 按注册顺序匹配处理该模型的适配器，未匹配时直接返回错误
+func (h *Handler) match(gtx *gin.Context, mod string) (inter.Adapter, bool) {
 	for _, extension := range h.extensions {
-		ok, err := extension.Match(gtx, completion.Model)
+		ok, err := extension.Match(gtx, mod)
 		if err != nil {
 			response.Error(gtx, -1, err)
-			return
+			return nil, false
 		}
-		if !ok {
-			continue
+		if ok {
+			return extension, true
 		}
+	}
+	response.Error(gtx, -1, fmt.Sprintf("model '%s' is not not yet supported", mod))
+	return nil, false
+}
 
-		messages, err := extension.HandleMessages(gtx, completion)
+func dispatch(gtx *gin.Context, extension inter.Adapter, completion model.Completion) {
+	if completion.N > 1 {
+		completeChoices(gtx, extension, completion)
+		return
+	}
+
+	if needCache(gtx, completion) {
+		completeCache(gtx, extension, completion)
+		return
+	}
+
+	complete(gtx, extension, completion)
+}
+
+func complete(gtx *gin.Context, extension inter.Adapter, completion model.Completion) {
+	if needFormat(completion) {
+		completeFormat(gtx, extension, completion)
+		return
+	}
+	if needMCP(completion) {
+		completeMCP(gtx, extension, completion)
+		return
+	}
+	execute(gtx, extension, completion)
+}
+
+func execute(gtx *gin.Context, extension inter.Adapter, completion model.Completion) {
+	// 号池会把 token 替换为账号凭证，先记下客户端 key
+	token := gtx.GetString("token")
+	messages, err := extension.HandleMessages(gtx, completion)
+	if err != nil {
+		logger.Error("Error handling messages: ", err)
+		response.Error(gtx, 500, err)
+		return
+	}
+
+	completion.Messages = messages
+	gtx.Set(vars.GinCompletion, completion)
+
+	if toolcall.NeedExec(gtx) {
+		ok, err := extension.ToolChoice(gtx)
 		if err != nil {
-			logger.Error("Error handling messages: ", err)
 			response.Error(gtx, 500, err)
 			return
 		}
-
-		completion.Messages = messages
-		gtx.Set(vars.GinCompletion, completion)
-
-		if toolcall.NeedExec(gtx) {
-			if ok, err = extension.ToolChoice(gtx); err != nil {
-				response.Error(gtx, 500, err)
-				return
-			}
-			if ok {
-				return
-			}
+		if ok {
+			trackCost(gtx, token, completion.Model)
+			return
 		}
+	}
 
-		if err = extension.Completion(gtx); err != nil {
-			response.Error(gtx, 500, err)
-		}
+	if err = extension.Completion(gtx); err != nil {
+		response.Error(gtx, 500, err)
 		return
 	}
-	response.Error(gtx, -1, fmt.Sprintf("model '%s' is not not yet supported", completion.Model))
+	trackCost(gtx, token, completion.Model)
+}
+
+func newMatchers(gtx *gin.Context, completion model.Completion) []inter.Matcher {
+	return response.NewMatchers(gtx, func(str string) {
+		if completion.Stream {
+			response.SSEResponse(gtx, "matcher", str, time.Now().Unix())
+		}
+	})
 }
 
 // @POST(path = "
@@ -147,9 +230,12 @@ func (h *Handler) generations(gtx *gin.Context) {
 			return
 		}
 		if ok {
+			token := gtx.GetString("token")
 			if err = extension.Generation(gtx); err != nil {
 				response.Error(gtx, 500, err)
+				return
 			}
+			trackImages(gtx, token, generation)
 			return
 		}
 	}
@@ -172,3 +258,121 @@ func (h *Handler) models(gtx *gin.Context) {
 		"data":   models,
 	})
 }
+
+// @POST(path = "
+//
+//	v1/tokenize,
+//	proxies/v1/tokenize
+//
+// ")
+func (h *Handler) tokenize(gtx *gin.Context) {
+	// input 为字符串或字符串数组，messages 按对话格式计入消息开销
+	var req struct {
+		Model    string                    `json:"model"`
+		Input    interface{}               `json:"input"`
+		Messages []model.Keyv[interface{}] `json:"messages"`
+	}
+	if err := gtx.BindJSON(&req); err != nil {
+		logger.Error(err)
+		response.Error(gtx, -1, err)
+		return
+	}
+
+	var inputs []string
+	switch input := req.Input.(type) {
+	case nil:
+	case string:
+		inputs = append(inputs, input)
+	case []interface{}:
+		for _, item := range input {
+			str, ok := item.(string)
+			if !ok {
+				response.Error(gtx, http.StatusBadRequest, "'input' must be a string or an array of strings")
+				return
+			}
+			inputs = append(inputs, str)
+		}
+	default:
+		response.Error(gtx, http.StatusBadRequest, "'input' must be a string or an array of strings")
+		return
+	}
+
+	data := make([]gin.H, 0, len(inputs))
+	tokens := 0
+	for index, input := range inputs {
+		count := tokenizer.Count(req.Model, input)
+		tokens += count
+		data = append(data, gin.H{"index": index, "tokens": count})
+	}
+	if len(req.Messages) > 0 {
+		tokens += window.Count(req.Model, req.Messages)
+	}
+
+	gtx.JSON(http.StatusOK, gin.H{
+		"object":    "tokenize",
+		"model":     req.Model,
+		"tokenizer": tokenizer.For(req.Model).Name(),
+		"tokens":    tokens,
+		"data":      data,
+	})
+}
+
+// @GET(path = "v1/costs")
+func (h *Handler) costs(gtx *gin.Context) {
+	records := pricing.Find(costQuery(gtx))
+	total := 0.0
+	for _, record := range records {
+		total += record.Cost
+	}
+	gtx.JSON(http.StatusOK, gin.H{
+		"object": "list",
+		"data":   records,
+		"total":  total,
+	})
+}
+
+// @GET(path = "metrics")
+func (h *Handler) metrics(gtx *gin.Context) {
+	// 设置了 metrics.token（未设置时取 server.password）时需携带该值访问
+	password := env.Env.GetString("metrics.token")
+	if password == "" {
+		password = env.Env.GetString("server.password")
+	}
+	if password != "" && password != gtx.GetString("token") {
+		response.Error(gtx, http.StatusUnauthorized, response.UnauthorizedError)
+		return
+	}
+	promhttp.Handler().ServeHTTP(gtx.Writer, gtx.Request)
+}
+
+// @GET(path = "v1/conversations")
+func (h *Handler) conversations(gtx *gin.Context) {
+	gtx.JSON(http.StatusOK, gin.H{
+		"object": "list",
+		"data":   conversation.List(conversationOwner(gtx)),
+	})
+}
+
+// @GET(path = "v1/conversations/:id")
+func (h *Handler) getConversation(gtx *gin.Context) {
+	value, ok := conversation.Get(gtx.Param("id"), conversationOwner(gtx))
+	if !ok {
+		response.Error(gtx, http.StatusNotFound, "conversation not found")
+		return
+	}
+	gtx.JSON(http.StatusOK, value)
+}
+
+// @DEL(path = "v1/conversations/:id")
+func (h *Handler) delConversation(gtx *gin.Context) {
+	id := gtx.Param("id")
+	if !conversation.Delete(id, conversationOwner(gtx)) {
+		response.Error(gtx, http.StatusNotFound, "conversation not found")
+		return
+	}
+	gtx.JSON(http.StatusOK, gin.H{
+		"id":      id,
+		"object":  "conversation.deleted",
+		"deleted": true,
+	})
+}
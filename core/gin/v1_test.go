@@ -0,0 +1,35 @@
+package gin
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMetricsToken(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+		code  int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"client key", "sk-client", http.StatusUnauthorized},
+		{"metrics token", "metrics-secret", http.StatusOK},
+	}
+
+	h := &Handler{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gtx, w := newTestContext()
+			gtx.Request.Method, gtx.Request.URL.Path = http.MethodGet, "/metrics"
+			gtx.Set("token", tt.token)
+			h.metrics(gtx)
+			if w.Code != tt.code {
+				t.Errorf("status = %d, want %d", w.Code, tt.code)
+			}
+			if tt.code == http.StatusOK && !strings.Contains(w.Body.String(), "go_goroutines") {
+				t.Errorf("body = %.200s", w.Body.String())
+			}
+		})
+	}
+}
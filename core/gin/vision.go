@@ -0,0 +1,35 @@
+package gin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"chatgpt-adapter/core/common/vars"
+	"chatgpt-adapter/core/common/vision"
+	"chatgpt-adapter/core/gin/inter"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"github.com/gin-gonic/gin"
+)
+
+// 支持图片的适配器原样处理，需要图片内容的适配器自行通过 vision.Load 读取；
+// 不支持的适配器按 vision.fallback 拒绝或降级为纯文本
+func prepareVision(gtx *gin.Context, extension inter.Adapter, completion model.Completion) (model.Completion, bool) {
+	if extension.Vision(gtx, completion.Model) {
+		return completion, true
+	}
+
+	messages, err := vision.Degrade(completion.Messages)
+	if err != nil {
+		if errors.Is(err, vision.ErrUnsupported) {
+			err = fmt.Errorf("model '%s' does not support image input", completion.Model)
+		}
+		response.Error(gtx, http.StatusBadRequest, err)
+		return completion, false
+	}
+
+	completion.Messages = messages
+	gtx.Set(vars.GinCompletion, completion)
+	return completion, true
+}
@@ -0,0 +1,42 @@
+package gin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"chatgpt-adapter/core/gin/model"
+	v1 "chatgpt-adapter/relay/llm/v1"
+	"github.com/iocgo/sdk/env"
+)
+
+// 原样转发图片地址的适配器不应由服务端下载客户端提供的地址
+func TestPrepareVisionForwardsURLs(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer server.Close()
+
+	url := server.URL + "/internal.png"
+	completion := model.Completion{
+		Model: "a/main",
+		Messages: []model.Keyv[interface{}]{{"role": "user", "content": []interface{}{
+			map[string]interface{}{"type": "text", "text": "what is this?"},
+			map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": url}},
+		}}},
+	}
+
+	gtx, w := newTestContext()
+	result, ok := prepareVision(gtx, v1.New(env.Env), completion)
+	if !ok {
+		t.Fatalf("prepareVision() rejected the request: %s", w.Body.String())
+	}
+	if hits.Load() != 0 {
+		t.Errorf("image url fetched %d times, want 0", hits.Load())
+	}
+	if !result.Messages[0].IsSlice("content") {
+		t.Errorf("image content was not forwarded: %v", result.Messages[0])
+	}
+}
@@ -0,0 +1,154 @@
+package gin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"chatgpt-adapter/core/cache"
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/common/toolcall"
+	"chatgpt-adapter/core/common/vars"
+	"chatgpt-adapter/core/common/window"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/logger"
+	"github.com/gin-gonic/gin"
+)
+
+const windowHeader = "X-Context-Window"
+
+const summaryPrompt = "Summarize the following earlier part of a conversation. " +
+	"Keep facts, decisions, names, numbers, code identifiers and open questions; omit small talk. " +
+	"Reply with the summary only, in the language of the conversation.\n\n"
+
+// 超出模型预算时按策略裁剪消息，实际使用的策略写入 X-Context-Window 响应头
+func (h *Handler) applyWindow(gtx *gin.Context, completion model.Completion) model.Completion {
+	budget := window.BudgetOf(completion.Model, completion.MaxTokens)
+	if budget.Tokens <= 0 {
+		return completion
+	}
+
+	before := window.Count(completion.Model, completion.Messages)
+	if before <= budget.Tokens {
+		return completion
+	}
+
+	var (
+		messages []model.Keyv[interface{}]
+		dropped  int
+		strategy = budget.Strategy
+	)
+
+	switch strategy {
+	case window.StrategyLastN:
+		messages, dropped = window.LastN(completion.Model, completion.Messages, budget.Keep, budget.Tokens)
+	case window.StrategySummarize:
+		var err error
+		messages, dropped, err = h.summarize(gtx, completion, budget)
+		if err != nil {
+			logger.Warnf("context summarize failed, fallback to %s: %v", window.StrategyDropOldest, err)
+			strategy = window.StrategyDropOldest
+			messages, dropped = window.DropOldest(completion.Model, completion.Messages, budget.Tokens)
+		}
+	default:
+		strategy = window.StrategyDropOldest
+		messages, dropped = window.DropOldest(completion.Model, completion.Messages, budget.Tokens)
+	}
+
+	result := window.Result{
+		Strategy: strategy,
+		Before:   before,
+		After:    window.Count(completion.Model, messages),
+		Dropped:  dropped,
+		Budget:   budget.Tokens,
+	}
+	logger.Infof("context window applied: %s", result)
+	gtx.Header(windowHeader, result.String())
+
+	completion.Messages = messages
+	return completion
+}
+
+// 将放不下的早期对话交给 summary-model 生成摘要，以 system 消息的形式插入到最近的对话之前。
+// 最近的对话占预算的 3/4，至少保留 keep 条；相同的早期对话复用缓存的摘要
+func (h *Handler) summarize(gtx *gin.Context, completion model.Completion, budget window.Budget) (messages []model.Keyv[interface{}], dropped int, err error) {
+	system, rest := window.Split(completion.Messages)
+	pos := window.Fit(completion.Model, rest, (budget.Tokens-window.Count(completion.Model, system))*3/4)
+	if keep := len(rest) - budget.Keep; pos > keep {
+		pos = max(keep, 0)
+		for pos < len(rest)-1 && rest[pos].Is("role", "tool") {
+			pos++
+		}
+	}
+	if pos == 0 {
+		return nil, 0, errors.New("nothing to summarize")
+	}
+
+	transcript := window.Transcript(rest[:pos])
+	key := common.CalcHex(window.SummaryModel() + transcript)
+	cacheManager := cache.SummaryCacheManager()
+	summary, err := cacheManager.GetValue(key)
+	if err != nil {
+		logger.Error(err)
+	}
+
+	if summary == "" {
+		summary, err = h.ask(gtx, window.SummaryModel(), summaryPrompt+transcript)
+		if err != nil {
+			return
+		}
+		if err = cacheManager.SetValue(key, summary); err != nil {
+			logger.Error(err)
+		}
+	}
+
+	messages = append(messages, system...)
+	messages = append(messages, model.Keyv[interface{}]{
+		"role":    "system",
+		"content": "Summary of the earlier conversation:\n" + summary,
+	})
+	messages = append(messages, rest[pos:]...)
+
+	// 摘要后仍超出预算时继续丢弃最早的对话
+	if window.Count(completion.Model, messages) > budget.Tokens {
+		var more int
+		messages, more = window.DropOldest(completion.Model, messages, budget.Tokens)
+		pos += more
+	}
+	return messages, pos, nil
+}
+
+// 以非流式、不带工具的方式请求指定模型，返回回复内容
+func (h *Handler) ask(gtx *gin.Context, mod, content string) (string, error) {
+	completion := model.Completion{
+		Model:      mod,
+		Messages:   []model.Keyv[interface{}]{{"role": "user", "content": content}},
+		ToolChoice: toolcall.ChoiceNone,
+	}
+
+	for _, extension := range h.extensions {
+		// Match 会写入上游地址、模型等请求级的值，在副本上进行，避免覆盖主请求已匹配的结果
+		ctx := gtx.Copy()
+		ok, err := extension.Match(ctx, completion.Model)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			continue
+		}
+
+		rec := newRecorder(gtx.Writer)
+		ctx.Writer = rec
+		ctx.Set(vars.GinCompletion, completion)
+		ctx.Set(vars.GinMatchers, newMatchers(ctx, completion))
+		execute(ctx, extension, completion)
+
+		var res model.Response
+		if err = json.Unmarshal(rec.buffer.Bytes(), &res); err != nil || res.Error != nil || len(res.Choices) == 0 || res.Choices[0].Message == nil {
+			_, err = rec.error()
+			return "", err
+		}
+		return res.Choices[0].Message.Content, nil
+	}
+	return "", fmt.Errorf("model '%s' is not not yet supported", mod)
+}
@@ -0,0 +1,64 @@
+package gin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"chatgpt-adapter/core/common/vars"
+	"chatgpt-adapter/core/gin/inter"
+	"chatgpt-adapter/core/gin/model"
+	v1 "chatgpt-adapter/relay/llm/v1"
+	"github.com/gin-gonic/gin"
+	"github.com/iocgo/sdk/env"
+)
+
+func newTestContext() (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	gtx, _ := gin.CreateTestContext(w)
+	gtx.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	return gtx, w
+}
+
+// 摘要模型与主模型位于不同的 custom-llm 前缀时，摘要请求不能改写主请求匹配到的上游
+func TestAskKeepsMatchedUpstream(t *testing.T) {
+	upstreamA.reset(nil)
+	upstreamB.reset(nil)
+
+	h := &Handler{[]inter.Adapter{v1.New(env.Env)}}
+	gtx, w := newTestContext()
+	extension, ok := h.match(gtx, "a/main")
+	if !ok {
+		t.Fatal("model 'a/main' is not matched")
+	}
+
+	content, err := h.ask(gtx, "b/sum", "summarize the conversation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "summary" {
+		t.Errorf("ask() = %q, want %q", content, "summary")
+	}
+	if requests := upstreamB.received(); len(requests) != 1 || requests[0].Model != "sum" {
+		t.Errorf("summary upstream received %+v, want one request for 'sum'", requests)
+	}
+
+	completion := model.Completion{
+		Model:    "a/main",
+		Messages: []model.Keyv[interface{}]{{"role": "user", "content": "hello"}},
+	}
+	gtx.Set(vars.GinCompletion, completion)
+	gtx.Set(vars.GinMatchers, newMatchers(gtx, completion))
+	execute(gtx, extension, completion)
+
+	if requests := upstreamA.received(); len(requests) != 1 || requests[0].Model != "main" {
+		t.Errorf("main upstream received %+v, want one request for 'main'", requests)
+	}
+	if requests := upstreamB.received(); len(requests) != 1 {
+		t.Errorf("summary upstream received %d requests after execute, want 1", len(requests))
+	}
+	if body := w.Body.String(); !strings.Contains(body, `"content":"main"`) {
+		t.Errorf("response = %s, want the main upstream reply", body)
+	}
+}
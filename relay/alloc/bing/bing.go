@@ -1,6 +1,8 @@
 package bing
 
 import (
+	"fmt"
+	"strconv"
 	"time"
 
 	"chatgpt-adapter/core/common"
@@ -29,15 +31,25 @@ func init() {
 			if !o {
 				return
 			}
-			return map[string]string{
+			obj = map[string]string{
 				"scopeId": m["scopeid"].(string),
 				"idToken": m["idtoken"].(string),
 				"cookie":  m["cookie"].(string),
 			}
+			if capacity, exists := m["capacity"]; exists {
+				obj["capacity"] = fmt.Sprint(capacity)
+			}
+			return
 		}).ToSlice()
 
 		cookiesContainer = common.NewPollContainer[map[string]string]("bing", slice, 6*time.Hour)
 		cookiesContainer.Condition = condition
+		cookiesContainer.Weight = func(cookie map[string]string) int {
+			if capacity, err := strconv.Atoi(cookie["capacity"]); err == nil {
+				return capacity
+			}
+			return 1
+		}
 	})
 }
 
@@ -59,29 +71,41 @@ func InvocationHandler(ctx *proxy.Context) {
 		return
 	}
 
-	cookie, err := cookiesContainer.Poll()
-	if err != nil {
-		logger.Error(err)
-		response.Error(gtx, -1, err)
-		return
-	}
-	defer resetMarked(cookie)
-	gtx.Set("token", cookie)
+	key := common.ConversationKey(common.GetGinCompletion(gtx))
+	for retry := 0; ; retry++ {
+		cookie, err := cookiesContainer.PollWith(key)
+		if err != nil {
+			logger.Error(err)
+			if retry == 0 {
+				response.Error(gtx, -1, err)
+			}
+			return
+		}
+		gtx.Set("token", cookie)
 
-	//
-	ctx.Do()
+		//
+		ctx.Do()
 
-	//
-	if ctx.Method == "Completion" {
-		err = elseOf[error](ctx.Out[0])
-	}
-	if ctx.Method == "ToolChoice" {
-		err = elseOf[error](ctx.Out[1])
-	}
+		//
+		if ctx.Method == "Completion" {
+			err = elseOf[error](ctx.Out[0])
+		}
+		if ctx.Method == "ToolChoice" {
+			err = elseOf[error](ctx.Out[1])
+		}
+
+		if err == nil {
+			resetMarked(cookie)
+			return
+		}
 
-	if err != nil {
 		logger.Error(err)
-		return
+		canRetry := cookiesContainer.HandleError(cookie, err)
+		resetMarked(cookie)
+		if !canRetry || retry >= common.PollRetries() || gtx.Writer.Written() {
+			return
+		}
+		logger.Infof("bing 切换账号重试: %d", retry+1)
 	}
 }
 
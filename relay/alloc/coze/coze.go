@@ -26,6 +26,9 @@ type account struct {
 	E string `mapstructure:"email" json:"email"`
 	P string `mapstructure:"password" json:"password"`
 	V string `mapstructure:"validate" json:"validate"`
+
+	// weighted 策略的容量
+	Capacity int `mapstructure:"capacity" json:"-"`
 }
 
 var (
@@ -49,6 +52,12 @@ func init() {
 
 		cookiesContainer = common.NewPollContainer("coze", make([]*account, 0), 60*time.Second) // 报错进入60秒冷却
 		cookiesContainer.Condition = condition(env.GetString("server.proxied"))
+		cookiesContainer.Weight = func(meta *account) int {
+			if meta.Capacity > 0 {
+				return meta.Capacity
+			}
+			return 1
+		}
 		run(env, values...)
 	})
 }
@@ -76,7 +85,7 @@ func InvocationHandler(ctx *proxy.Context) {
 	)
 
 	if isSdk(context, completion.Model) {
-		meta, err = cookiesContainer.Poll()
+		meta, err = cookiesContainer.PollWith(common.ConversationKey(completion))
 		if err != nil {
 			logger.Error(err)
 			response.Error(context, -1, err)
@@ -90,6 +99,7 @@ func InvocationHandler(ctx *proxy.Context) {
 		completion.Model, err = sdkModel(context, proxied, cookies)
 		if err != nil {
 			logger.Error(err)
+			cookiesContainer.HandleError(meta, err)
 			response.Error(context, -1, err)
 			return
 		}
@@ -128,7 +138,11 @@ func InvocationHandler(ctx *proxy.Context) {
 	}
 
 	if err != nil {
-		if meta != nil {
+		if meta == nil {
+			return
+		}
+		// coze-api 的错误只有文案，未能归类时按原逻辑冷却
+		if !cookiesContainer.HandleError(meta, err) {
 			_ = cookiesContainer.MarkTo(meta, 2)
 			logger.Infof("coze websdk[%s] 进入冷却状态", meta.E)
 		}
@@ -186,7 +200,7 @@ func draftBot(ctx *gin.Context, systemMessage string, chat coze.Chat, completion
 	if err = chat.DraftBot(ctx.Request.Context(), coze.DraftInfo{
 		Model:            value["model"].(string),
 		TopP:             completion.TopP,
-		Temperature:      completion.Temperature,
+		Temperature:      completion.GetTemperature(0),
 		MaxTokens:        completion.MaxTokens,
 		FrequencyPenalty: 0,
 		PresencePenalty:  0,
@@ -0,0 +1,127 @@
+package pool
+
+import (
+	"time"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/common/vars"
+	"chatgpt-adapter/core/gin/response"
+	"chatgpt-adapter/core/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/iocgo/sdk/env"
+	"github.com/iocgo/sdk/proxy"
+)
+
+// 凭证池，凭证从配置读取，池为空或无可用凭证时使用客户端携带的 token：
+//
+//	deepseek:
+//	  tokens: [ "xxx", "yyy" ]
+//	  capacities: [ 2, 1 ]   # 可选，weighted 策略的容量，与 tokens 按顺序对应
+type Pool struct {
+	name      string
+	container *common.PollContainer[string]
+}
+
+func New(env *env.Environment, name string, resetTime time.Duration) *Pool {
+	tokens := env.GetStringSlice(name + ".tokens")
+	container := common.NewPollContainer[string](name, tokens, resetTime)
+	container.Condition = func(token string) bool {
+		marker, err := container.Marked(token)
+		if err != nil {
+			logger.Error(err)
+			return false
+		}
+		return marker == 0
+	}
+
+	capacities := make(map[string]int)
+	for i, capacity := range env.GetIntSlice(name + ".capacities") {
+		if i < len(tokens) {
+			capacities[tokens[i]] = capacity
+		}
+	}
+	container.Weight = func(token string) int {
+		if capacity, ok := capacities[token]; ok {
+			return capacity
+		}
+		return 1
+	}
+
+	if len(tokens) > 0 {
+		logger.Infof("[%s] 凭证池已加载 %d 个凭证", name, len(tokens))
+	}
+	return &Pool{name, container}
+}
+
+func (pool *Pool) Handle(ctx *proxy.Context) {
+	var (
+		gtx  = ctx.In[0].(*gin.Context)
+		echo = gtx.GetBool(vars.GinEcho)
+	)
+
+	if echo || ctx.Method != "Completion" && ctx.Method != "ToolChoice" || pool == nil || pool.container.Len() == 0 {
+		ctx.Do()
+		return
+	}
+
+	logger.Infof("execute static proxy [relay/llm/%s.api]: func %s(...)", pool.name, ctx.Method)
+
+	var (
+		client = gtx.GetString("token")
+		key    = common.ConversationKey(common.GetGinCompletion(gtx))
+	)
+
+	for retry := 0; ; retry++ {
+		token, err := pool.container.PollWith(key)
+		if err != nil {
+			// 池中暂无可用凭证
+			if retry == 0 && client != "" {
+				logger.Warnf("[%s] 凭证池无可用凭证，使用客户端 token: %v", pool.name, err)
+				ctx.Do()
+			} else if retry == 0 {
+				logger.Error(err)
+				response.Error(gtx, -1, err)
+			}
+			return
+		}
+		gtx.Set("token", token)
+
+		ctx.Do()
+
+		if ctx.Method == "Completion" {
+			err, _ = ctx.Out[0].(error)
+		}
+		if ctx.Method == "ToolChoice" {
+			err, _ = ctx.Out[1].(error)
+		}
+
+		if err == nil {
+			pool.resetMarked(token)
+			return
+		}
+
+		logger.Error(err)
+		canRetry := pool.container.HandleError(token, err)
+		pool.resetMarked(token)
+		if !canRetry || retry >= common.PollRetries() || gtx.Writer.Written() {
+			return
+		}
+		logger.Infof("[%s] 切换凭证重试: %d", pool.name, retry+1)
+	}
+}
+
+func (pool *Pool) resetMarked(token string) {
+	marker, err := pool.container.Marked(token)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	if marker != 1 {
+		return
+	}
+
+	if err = pool.container.MarkTo(token, 0); err != nil {
+		logger.Error(err)
+	}
+}
@@ -0,0 +1,22 @@
+package windsurf
+
+import (
+	"time"
+
+	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/relay/alloc/pool"
+	"github.com/iocgo/sdk/env"
+	"github.com/iocgo/sdk/proxy"
+)
+
+var (
+	tokensPool *pool.Pool
+)
+
+func init() {
+	inited.AddInitialized(func(env *env.Environment) {
+		tokensPool = pool.New(env, "windsurf", time.Hour) // 报错进入1小时冷却
+	})
+}
+
+func InvocationHandler(ctx *proxy.Context) { tokensPool.Handle(ctx) }
@@ -5,7 +5,6 @@ import (
 	"context"
 	"errors"
 	"net/http"
-	"strings"
 	"sync"
 	"time"
 
@@ -37,6 +36,20 @@ func init() {
 		cookies := env.GetStringSlice("you.cookies")
 		cookiesContainer = common.NewPollContainer[string]("you", cookies, 6*time.Hour)
 		cookiesContainer.Condition = condition(env)
+
+		// you.capacities 与 you.cookies 按顺序对应
+		capacities := make(map[string]int)
+		for i, capacity := range env.GetIntSlice("you.capacities") {
+			if i < len(cookies) {
+				capacities[cookies[i]] = capacity
+			}
+		}
+		cookiesContainer.Weight = func(cookie string) int {
+			if capacity, ok := capacities[cookie]; ok {
+				return capacity
+			}
+			return 1
+		}
 		if len(cookies) > 0 && env.GetBool("you.task") {
 			go timer(env)
 		}
@@ -102,44 +115,50 @@ func InvocationHandler(ctx *proxy.Context) {
 		return
 	}
 
-	cookies, err := cookiesContainer.Poll()
-	if err != nil {
-		logger.Error(err)
-		response.Error(gtx, -1, err)
-		return
-	}
-	defer resetMarked(cookies)
-	gtx.Set("token", cookies)
-	gtx.Set("clearance", clearance)
-	gtx.Set("userAgent", userAgent)
-	gtx.Set("lang", lang)
-
-	//
-	ctx.Do()
-
-	//
-	if ctx.Method == "Completion" {
-		err = elseOf[error](ctx.Out[0])
-	}
-	if ctx.Method == "ToolChoice" {
-		err = elseOf[error](ctx.Out[1])
-	}
+	key := common.ConversationKey(common.GetGinCompletion(gtx))
+	for retry := 0; ; retry++ {
+		cookies, err := cookiesContainer.PollWith(key)
+		if err != nil {
+			logger.Error(err)
+			if retry == 0 {
+				response.Error(gtx, -1, err)
+			}
+			return
+		}
+		gtx.Set("token", cookies)
+		gtx.Set("clearance", clearance)
+		gtx.Set("userAgent", userAgent)
+		gtx.Set("lang", lang)
+
+		//
+		ctx.Do()
+
+		//
+		if ctx.Method == "Completion" {
+			err = elseOf[error](ctx.Out[0])
+		}
+		if ctx.Method == "ToolChoice" {
+			err = elseOf[error](ctx.Out[1])
+		}
+
+		if err == nil {
+			resetMarked(cookies)
+			return
+		}
 
-	if err != nil {
 		logger.Error(err)
 		var se emit.Error
-		if errors.As(err, &se) && se.Code > 400 {
-			_ = cookiesContainer.MarkTo(cookies, 2)
-			// 403 重定向？？？
-			if se.Code == 403 {
-				cleanCloudflare()
-			}
+		// 403 重定向？？？
+		if errors.As(err, &se) && se.Code == 403 {
+			cleanCloudflare()
 		}
 
-		if strings.Contains(err.Error(), "ZERO QUOTA") {
-			_ = cookiesContainer.MarkTo(cookies, 2)
+		canRetry := cookiesContainer.HandleError(cookies, err)
+		resetMarked(cookies)
+		if !canRetry || retry >= common.PollRetries() || gtx.Writer.Written() {
+			return
 		}
-		return
+		logger.Infof("you.com 切换账号重试: %d", retry+1)
 	}
 }
 
@@ -171,10 +190,8 @@ func condition(env *env.Environment) func(string) bool {
 					cleanCloudflare()
 					_ = hookCloudflare(env)
 				}
-				if se.Code == 401 { // cookie 失效？？？
-					_ = cookiesContainer.MarkTo(cookies, 2)
-				}
 			}
+			cookiesContainer.HandleError(cookies, err)
 			logger.Error(err)
 			return false
 		}
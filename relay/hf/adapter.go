@@ -265,9 +265,9 @@ func completeTagsGenerator(ctx *gin.Context, env *env.Environment, content strin
 		return strings.Join(contents, ", "), nil
 	}
 
-	w := agent.SDWords
+	w := agent.Template(agent.NameSDWords, mod)
 	if ctx.GetString(ginSpace) == "dalle-4k" || ctx.GetString(ginSpace) == "dalle-3xl" {
-		w = agent.SD2Words
+		w = agent.Template(agent.NameSD2Words, mod)
 	}
 
 	obj := map[string]interface{}{
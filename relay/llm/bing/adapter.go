@@ -2,7 +2,6 @@ package bing
 
 import (
 	"context"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
@@ -12,6 +11,7 @@ import (
 
 	"chatgpt-adapter/core/cache"
 	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/common/vision"
 	"chatgpt-adapter/core/gin/inter"
 	"chatgpt-adapter/core/gin/model"
 	"chatgpt-adapter/core/gin/response"
@@ -46,6 +46,9 @@ func (api *api) Match(ctx *gin.Context, model string) (ok bool, err error) {
 	return
 }
 
+// 只取最后一张图片作为附件上传
+func (*api) Vision(_ *gin.Context, model string) bool { return model == Model }
+
 func (*api) Models() (slice []model.Model) {
 	slice = append(slice, model.Model{
 		Id:      Model,
@@ -134,23 +137,12 @@ label:
 }
 
 func extAttr(ctx *gin.Context, proxied bool, attr, accessToken string) (ret string, err error) {
-	var buffer []byte
-	if strings.HasPrefix(attr, "http") {
-		buffer, err = common.DownloadBuffer(common.HTTPClient, "", attr, nil)
-	} else if strings.HasPrefix(attr, "data:image/") {
-		if pos := strings.Index(attr, ";"); pos > 0 {
-			attr = attr[pos+1:]
-		}
-		if strings.HasPrefix(attr, "base64,") {
-			attr = attr[7:]
-		}
-		buffer, err = base64.StdEncoding.DecodeString(attr)
-	}
+	image, err := vision.Load(attr)
 	if err != nil {
 		return
 	}
 
-	ret, err = edge.Attachments(elseOf(proxied, common.HTTPClient, common.NopHTTPClient), ctx.Request.Context(), buffer, accessToken)
+	ret, err = edge.Attachments(elseOf(proxied, common.HTTPClient, common.NopHTTPClient), ctx.Request.Context(), image.Data, accessToken)
 	return
 }
 
@@ -246,7 +238,7 @@ func genToken(ctx context.Context, ident map[string]string, proxied, nTok bool)
 		return
 	}
 
-	err = cacheManager.SetWithExpiration(cookie, accessToken, time.Hour)
+	err = cacheManager.SetValue(cookie, accessToken)
 	accessToken = strings.Split(accessToken, "|")[1]
 	return
 }
@@ -8,6 +8,7 @@ import (
 	"github.com/bincooo/emit.io"
 	"github.com/iocgo/sdk/env"
 	"net/http"
+	"strings"
 	"time"
 
 	"chatgpt-adapter/core/common"
@@ -68,6 +69,7 @@ func waitResponse(ctx *gin.Context, message chan []byte, sse bool) (content stri
 
 	for {
 
+		// 上游的 done 事件由 edge-api 转换为关闭通道
 		chunk, ok := <-message
 		if !ok {
 			raw := response.ExecMatchers(matchers, "", true)
@@ -81,6 +83,11 @@ func waitResponse(ctx *gin.Context, message chan []byte, sse bool) (content stri
 		magic := chunk[0]
 		chunk = chunk[1:]
 		if magic == 1 {
+			// 疑似审查拦截时保留已输出的内容，以 content_filter 结束
+			if content != "" && isFiltered(chunk) {
+				response.SetFinishReason(ctx, "content_filter")
+				break
+			}
 			asError(ctx, string(chunk))
 			break
 		}
@@ -124,7 +131,7 @@ func waitResponse(ctx *gin.Context, message chan []byte, sse bool) (content stri
 	if content == "" && response.NotSSEHeader(ctx) {
 		return
 	}
-	ctx.Set(vars.GinCompletionUsage, response.CalcUsageTokens(content, tokens))
+	ctx.Set(vars.GinCompletionUsage, response.CalcUsageTokens(common.GetGinCompletion(ctx).Model, content, tokens))
 	if !sse {
 		response.Response(ctx, Model, content)
 	} else {
@@ -133,6 +140,22 @@ func waitResponse(ctx *gin.Context, message chan []byte, sse bool) (content stri
 	return
 }
 
+// 上游没有专门的审查事件，只对 {"event":"error"} 帧按关键字估算；连接错误等本地错误不参与判断
+func isFiltered(chunk []byte) bool {
+	var msg model.Keyv[interface{}]
+	if err := json.Unmarshal(chunk, &msg); err != nil || !msg.Is("event", "error") {
+		return false
+	}
+
+	str := strings.ToLower(string(chunk))
+	for _, keyword := range []string{"filter", "moderat", "blocked", "safety"} {
+		if strings.Contains(str, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
 func asError(ctx *gin.Context, msg interface{}) {
 	if msg == nil || msg == "" {
 		return
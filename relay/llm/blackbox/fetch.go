@@ -77,7 +77,7 @@ func convertRequest(ctx *gin.Context, env *env.Environment, completion model.Com
 	request.CodeModelMode = true
 	request.MaxTokens = completion.MaxTokens
 	request.PlaygroundTopP = completion.TopP
-	request.PlaygroundTemperature = completion.Temperature
+	request.PlaygroundTemperature = completion.GetTemperature(0)
 	request.UserSelectedModel = completion.Model[9:]
 	request.Validated = env.GetString("blackbox.token")
 	request.AgentMode = struct{}{}
@@ -100,7 +100,8 @@ func waitResponse(ctx *gin.Context, chatResponse chan string, sse bool) (content
 		return
 	}
 
-	ctx.Set(vars.GinCompletionUsage, response.CalcUsageTokens(content, tokens))
+	// coze-api 不转发结束原因，按默认的 stop 返回
+	ctx.Set(vars.GinCompletionUsage, response.CalcUsageTokens(common.GetGinCompletion(ctx).Model, content, tokens))
 	if !sse {
 		response.Response(ctx, Model, content)
 	} else {
@@ -126,7 +127,7 @@ func mergeMessages(ctx *gin.Context) (newMessages []coze.Message, err error) {
 			Role:    "user",
 			Content: message,
 		})
-		tokens += response.CalcTokens(message)
+		tokens += response.CalcTokens(completion.Model, message)
 		return
 	}
 
@@ -155,7 +156,7 @@ func mergeMessages(ctx *gin.Context) (newMessages []coze.Message, err error) {
 	}
 
 	message := strings.Join(contents, "")
-	tokens += response.CalcTokens(message)
+	tokens += response.CalcTokens(completion.Model, message)
 	newMessages = append(newMessages, coze.Message{
 		Role:    "user",
 		Content: message,
@@ -104,7 +104,7 @@ func genChecksum(ctx *gin.Context, env *env.Environment) string {
 			checksum = emit.TextResponse(response)
 			response.Body.Close()
 
-			_ = cacheManager.SetWithExpiration(common.CalcHex(token), checksum, 30*time.Minute) // 缓存30分钟
+			_ = cacheManager.SetValue(common.CalcHex(token), checksum) // 默认缓存30分钟
 			return checksum
 		}
 	}
@@ -173,7 +173,7 @@ func waitResponse(ctx *gin.Context, r *http.Response, sse bool) (content string)
 		return
 	}
 
-	ctx.Set(vars.GinCompletionUsage, response.CalcUsageTokens(content, tokens))
+	ctx.Set(vars.GinCompletionUsage, response.CalcUsageTokens(common.GetGinCompletion(ctx).Model, content, tokens))
 	if !sse {
 		response.Response(ctx, Model, content)
 	} else {
@@ -29,6 +29,11 @@ func (api *api) Match(ctx *gin.Context, model string) (ok bool, err error) {
 	return
 }
 
+// 图片与文件通过上传接口传入 ref_file_ids
+func (*api) Vision(_ *gin.Context, model string) bool { return true }
+
+func (*api) Files(_ *gin.Context, model string) bool { return true }
+
 func (api *api) Models() (slice []model.Model) {
 	slice = append(slice, model.Model{
 		Id:      Model + "/v3",
@@ -3,6 +3,7 @@ package deepseek
 import (
 	"bytes"
 	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/common/vision"
 	"chatgpt-adapter/core/gin/model"
 	"chatgpt-adapter/core/gin/response"
 	"chatgpt-adapter/core/logger"
@@ -35,16 +36,45 @@ const (
 //}
 
 type deepseekRequest struct {
-	ChatSessionId   string `json:"chat_session_id"`
-	ParentMessageId *int   `json:"parent_message_id"`
-	Message         string `json:"prompt"`
-	RefFileIds      []int  `json:"ref_file_ids"`
-	ThinkingEnabled bool   `json:"thinking_enabled"`
-	SearchEnabled   bool   `json:"search_enabled"`
+	ChatSessionId   string   `json:"chat_session_id"`
+	ParentMessageId *int     `json:"parent_message_id"`
+	Message         string   `json:"prompt"`
+	RefFileIds      []string `json:"ref_file_ids"`
+	ThinkingEnabled bool     `json:"thinking_enabled"`
+	SearchEnabled   bool     `json:"search_enabled"`
 }
 
 func fetch(ctx context.Context, proxied, cookie string, request deepseekRequest) (response *http.Response, err error) {
+	challenge, err := pow(ctx, proxied, cookie, "/api/v0/chat/completion")
+	if err != nil {
+		return
+	}
+
 	response, err = emit.ClientBuilder(common.HTTPClient).
+		Context(ctx).
+		Proxies(proxied).
+		POST("https://chat.deepseek.com/api/v0/chat/completion").
+		JSONHeader().
+		Header("authorization", "Bearer "+cookie).
+		Header("origin", "https://chat.deepseek.com").
+		Header("referer", "https://chat.deepseek.com/").
+		Header("user-agent", userAgent).
+		Header("x-app-version", "20241129.1").
+		Header("x-client-locale", "zh_CN").
+		Header("x-client-platform", "web").
+		Header("x-client-version", "1.0.0-always").
+		Header("x-ds-pow-response", challenge).
+		Body(request).
+		DoC(emit.Status(http.StatusOK), emit.IsSTREAM)
+	if err != nil && response != nil {
+		err = common.WithRetryAfter(err, response.Header)
+	}
+	return
+}
+
+// 计算 targetPath 的工作量证明，返回 x-ds-pow-response 请求头
+func pow(ctx context.Context, proxied, cookie, targetPath string) (value string, err error) {
+	response, err := emit.ClientBuilder(common.HTTPClient).
 		Context(ctx).
 		Proxies(proxied).
 		POST("https://chat.deepseek.com/api/v0/chat/create_pow_challenge").
@@ -57,20 +87,22 @@ func fetch(ctx context.Context, proxied, cookie string, request deepseekRequest)
 		Header("x-client-platform", "web").
 		Header("x-client-version", "1.0.0-always").
 		Body(map[string]interface{}{
-			"target_path": "/api/v0/chat/completion",
+			"target_path": targetPath,
 		}).
 		DoC(emit.Status(http.StatusOK), emit.IsJSON)
 	if err != nil {
+		if response != nil {
+			err = common.WithRetryAfter(err, response.Header)
+		}
 		return
 	}
 
 	obj, err := emit.ToMap(response)
+	_ = response.Body.Close()
 	if err != nil {
-		_ = response.Body.Close()
 		return
 	}
 
-	_ = response.Body.Close()
 	if code, ok := obj["code"]; !ok || code.(float64) != 0 {
 		err = fmt.Errorf("create challenge failed")
 		msg := obj["msg"]
@@ -80,13 +112,13 @@ func fetch(ctx context.Context, proxied, cookie string, request deepseekRequest)
 		return
 	}
 
-	value, ok := obj["data"].(map[string]interface{})["biz_data"]
+	biz, ok := obj["data"].(map[string]interface{})["biz_data"]
 	if !ok {
 		err = fmt.Errorf("create challenge failed")
 		return
 	}
 
-	data := value.(map[string]interface{})
+	data := biz.(map[string]interface{})
 	data = data["challenge"].(map[string]interface{})
 	num, err := calcAnswer(data)
 	if err != nil {
@@ -99,28 +131,13 @@ func fetch(ctx context.Context, proxied, cookie string, request deepseekRequest)
 		"salt":        data["salt"],
 		"answer":      num,
 		"signature":   data["signature"],
-		"target_path": "/api/v0/chat/completion",
+		"target_path": targetPath,
 	})
 	if err != nil {
 		return
 	}
 
-	response, err = emit.ClientBuilder(common.HTTPClient).
-		Context(ctx).
-		Proxies(proxied).
-		POST("https://chat.deepseek.com/api/v0/chat/completion").
-		JSONHeader().
-		Header("authorization", "Bearer "+cookie).
-		Header("origin", "https://chat.deepseek.com").
-		Header("referer", "https://chat.deepseek.com/").
-		Header("user-agent", userAgent).
-		Header("x-app-version", "20241129.1").
-		Header("x-client-locale", "zh_CN").
-		Header("x-client-platform", "web").
-		Header("x-client-version", "1.0.0-always").
-		Header("x-ds-pow-response", base64.RawStdEncoding.EncodeToString(buf)).
-		Body(request).
-		DoC(emit.Status(http.StatusOK), emit.IsSTREAM)
+	value = base64.RawStdEncoding.EncodeToString(buf)
 	return
 }
 
@@ -309,24 +326,33 @@ func convertRequest(ctx *gin.Context, env *env.Environment, completion model.Com
 		return
 	}
 
+	data := value.(map[string]interface{})
+	sessionId := data["id"].(string)
+
+	// 上传图片与文件附件
+	fileIds, err := uploadAttachments(ctx.Request.Context(), env.GetString("server.proxied"), ctx.GetString("token"), completion.Messages)
+	if err != nil {
+		deleteSession(ctx, env, sessionId)
+		return
+	}
+
 	contentBuffer := new(bytes.Buffer)
 	if len(completion.Messages) == 1 {
-		contentBuffer.WriteString(completion.Messages[0].GetString("content"))
+		contentBuffer.WriteString(vision.Text(completion.Messages[0]))
 		goto label
 	}
 
 	for _, message := range completion.Messages {
 		role, end := response.ConvertRole(ctx, message.GetString("role"))
 		contentBuffer.WriteString(role)
-		contentBuffer.WriteString(message.GetString("content"))
+		contentBuffer.WriteString(vision.Text(message))
 		contentBuffer.WriteString(end)
 	}
 
 label:
-	data := value.(map[string]interface{})
 	request = deepseekRequest{
-		ChatSessionId:   data["id"].(string),
-		RefFileIds:      make([]int, 0),
+		ChatSessionId:   sessionId,
+		RefFileIds:      fileIds,
 		ThinkingEnabled: completion.Model[9:] == "r1",
 		SearchEnabled:   false,
 
@@ -52,7 +52,7 @@ func waitMessage(r *http.Response, cancel func(str string) bool) (content string
 			continue
 		}
 
-		if res.Choices[0].FinishReason != nil && *res.Choices[0].FinishReason == "stop" {
+		if finishReason := res.Choices[0].FinishReason; finishReason != nil && *finishReason != "" {
 			break
 		}
 
@@ -79,6 +79,7 @@ func waitResponse(ctx *gin.Context, r *http.Response, sse bool) (content string)
 
 	var (
 		matchers = common.GetGinMatchers(ctx)
+		usage    map[string]interface{}
 	)
 
 	defer r.Body.Close()
@@ -112,11 +113,15 @@ func waitResponse(ctx *gin.Context, r *http.Response, sse bool) (content string)
 			continue
 		}
 
+		if res.Usage != nil {
+			usage = res.Usage
+		}
 		if len(res.Choices) == 0 {
 			continue
 		}
 
-		if res.Choices[0].FinishReason != nil && *res.Choices[0].FinishReason == "stop" {
+		if finishReason := res.Choices[0].FinishReason; finishReason != nil && *finishReason != "" {
+			response.SetFinishReason(ctx, *finishReason)
 			break
 		}
 
@@ -147,7 +152,7 @@ func waitResponse(ctx *gin.Context, r *http.Response, sse bool) (content string)
 	if content == "" && response.NotSSEHeader(ctx) {
 		return
 	}
-	ctx.Set(vars.GinCompletionUsage, response.CalcUsageTokens(content, tokens))
+	ctx.Set(vars.GinCompletionUsage, response.ResolveUsage(common.GetGinCompletion(ctx).Model, usage, content, tokens))
 	if !sse {
 		response.Response(ctx, Model, content)
 	} else {
@@ -0,0 +1,215 @@
+package deepseek
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/common/vision"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/logger"
+	"github.com/bincooo/emit.io"
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/patrickmn/go-cache"
+)
+
+const (
+	uploadTimeout = 2 * time.Minute
+	pollInterval  = time.Second
+)
+
+// 已上传的附件：账号 + 内容哈希 => 文件 id，多轮对话重复发送时不再上传
+var files = cache.New(time.Hour, 10*time.Minute)
+
+// 上传消息中的图片与文件，等待解析完成后返回文件 id
+func uploadAttachments(ctx context.Context, proxied, cookie string, messages []model.Keyv[interface{}]) (ids []string, err error) {
+	ids = make([]string, 0)
+	for _, message := range messages {
+		for _, attachment := range vision.Attachments(message) {
+			var file *vision.Image
+			if attachment.Image {
+				file, err = vision.Load(attachment.URL)
+			} else {
+				file, err = vision.LoadFile(attachment.URL)
+			}
+			if err != nil {
+				return
+			}
+
+			key := common.CalcHex(cookie)[:16] + file.Hash
+			if value, ok := files.Get(key); ok {
+				ids = append(ids, value.(string))
+				continue
+			}
+
+			id, e := upload(ctx, proxied, cookie, attachment.Name, file)
+			if e != nil {
+				err = e
+				return
+			}
+
+			if err = waitParsed(ctx, proxied, cookie, id); err != nil {
+				return
+			}
+
+			files.SetDefault(key, id)
+			ids = append(ids, id)
+		}
+	}
+	return
+}
+
+func upload(ctx context.Context, proxied, cookie, filename string, file *vision.Image) (id string, err error) {
+	challenge, err := pow(ctx, proxied, cookie, "/api/v0/file/upload_file")
+	if err != nil {
+		return
+	}
+
+	if filename == "" {
+		filename = file.Hash[:16] + mimetype.Lookup(file.Mime).Extension()
+	}
+
+	var buffer bytes.Buffer
+	w := multipart.NewWriter(&buffer)
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, strings.ReplaceAll(filename, `"`, "")))
+	header.Set("Content-Type", file.Mime)
+	fw, err := w.CreatePart(header)
+	if err != nil {
+		return
+	}
+	if _, err = fw.Write(file.Data); err != nil {
+		return
+	}
+	_ = w.Close()
+
+	response, err := emit.ClientBuilder(common.HTTPClient).
+		Context(ctx).
+		Proxies(proxied).
+		POST("https://chat.deepseek.com/api/v0/file/upload_file").
+		Header("authorization", "Bearer "+cookie).
+		Header("origin", "https://chat.deepseek.com").
+		Header("referer", "https://chat.deepseek.com/").
+		Header("user-agent", userAgent).
+		Header("x-app-version", "20241129.1").
+		Header("x-client-locale", "zh_CN").
+		Header("x-client-platform", "web").
+		Header("x-client-version", "1.0.0-always").
+		Header("x-ds-pow-response", challenge).
+		Header("content-type", w.FormDataContentType()).
+		Bytes(buffer.Bytes()).
+		DoC(emit.Status(http.StatusOK), emit.IsJSON)
+	if err != nil {
+		if response != nil {
+			err = common.WithRetryAfter(err, response.Header)
+		}
+		return
+	}
+
+	obj, err := emit.ToMap(response)
+	_ = response.Body.Close()
+	if err != nil {
+		return
+	}
+
+	data, err := bizData(obj, "upload file failed")
+	if err != nil {
+		return
+	}
+
+	id, _ = data["id"].(string)
+	if id == "" {
+		err = fmt.Errorf("upload file failed")
+		return
+	}
+	logger.Infof("deepseek uploaded file: %s (%s, %d bytes)", id, file.Mime, len(file.Data))
+	return
+}
+
+// 轮询文件状态直至解析完成
+func waitParsed(ctx context.Context, proxied, cookie, id string) error {
+	timeout, cancel := context.WithTimeout(ctx, uploadTimeout)
+	defer cancel()
+
+	for {
+		response, err := emit.ClientBuilder(common.HTTPClient).
+			Context(timeout).
+			Proxies(proxied).
+			GET("https://chat.deepseek.com/api/v0/file/fetch_files").
+			Query("file_ids", id).
+			Header("authorization", "Bearer "+cookie).
+			Header("referer", "https://chat.deepseek.com/").
+			Header("user-agent", userAgent).
+			Header("x-app-version", "20241129.1").
+			Header("x-client-locale", "zh_CN").
+			Header("x-client-platform", "web").
+			Header("x-client-version", "1.0.0-always").
+			DoC(emit.Status(http.StatusOK), emit.IsJSON)
+		if err != nil {
+			return err
+		}
+
+		obj, err := emit.ToMap(response)
+		_ = response.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		data, err := bizData(obj, "fetch file failed")
+		if err != nil {
+			return err
+		}
+
+		status := ""
+		if slice, ok := data["files"].([]interface{}); ok && len(slice) > 0 {
+			if file, ok := slice[0].(map[string]interface{}); ok {
+				status, _ = file["status"].(string)
+			}
+		}
+
+		switch status {
+		case "SUCCESS":
+			return nil
+		case "", "PENDING", "PARSING":
+		default:
+			return fmt.Errorf("deepseek file %s parse failed: %s", id, status)
+		}
+
+		select {
+		case <-timeout.Done():
+			return fmt.Errorf("deepseek file %s parse timeout", id)
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func bizData(obj map[string]interface{}, message string) (data map[string]interface{}, err error) {
+	if code, ok := obj["code"]; !ok || code.(float64) != 0 {
+		err = fmt.Errorf(message)
+		if msg, ok := obj["msg"].(string); ok && msg != "" {
+			err = fmt.Errorf(msg)
+		}
+		return
+	}
+
+	value, _ := obj["data"].(map[string]interface{})
+	if code, ok := value["biz_code"].(float64); ok && code != 0 {
+		err = fmt.Errorf(message)
+		if msg, ok := value["biz_msg"].(string); ok && msg != "" {
+			err = fmt.Errorf(msg)
+		}
+		return
+	}
+
+	data, ok := value["biz_data"].(map[string]interface{})
+	if !ok {
+		err = fmt.Errorf(message)
+	}
+	return
+}
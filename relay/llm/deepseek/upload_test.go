@@ -0,0 +1,90 @@
+package deepseek
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/gin/model"
+)
+
+func TestBizData(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  string
+		want string
+		err  string
+	}{
+		{"ok", `{"code":0,"data":{"biz_code":0,"biz_data":{"id":"file-1"}}}`, "file-1", ""},
+		{"code", `{"code":40003,"msg":"INVALID_TOKEN"}`, "", "INVALID_TOKEN"},
+		{"code without msg", `{"code":1}`, "", "upload file failed"},
+		{"biz code", `{"code":0,"data":{"biz_code":1,"biz_msg":"file too large"}}`, "", "file too large"},
+		{"missing biz data", `{"code":0,"data":{"biz_code":0}}`, "", "upload file failed"},
+		{"missing code", `{}`, "", "upload file failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var obj map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.obj), &obj); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := bizData(obj, "upload file failed")
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("bizData() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil || data["id"] != tt.want {
+				t.Errorf("bizData() = %v, %v, want id %q", data, err, tt.want)
+			}
+		})
+	}
+}
+
+// 已上传过的内容直接复用文件 id，不再请求上游
+func TestUploadAttachmentsCached(t *testing.T) {
+	text := []byte("hello deepseek")
+	dataURL := "data:text/plain;base64," + base64.StdEncoding.EncodeToString(text)
+	hash := common.CalcHex(string(text))
+
+	files.SetDefault(common.CalcHex("cookie-a")[:16]+hash, "file-a")
+	defer files.Flush()
+
+	messages := []model.Keyv[interface{}]{
+		{"role": "system", "content": "plain text"},
+		{"role": "user", "content": []interface{}{
+			map[string]interface{}{"type": "text", "text": "summarize"},
+			map[string]interface{}{"type": "file", "file": map[string]interface{}{"filename": "a.txt", "file_data": dataURL}},
+		}},
+		{"role": "user", "content": []interface{}{
+			map[string]interface{}{"type": "file", "file": map[string]interface{}{"file_data": dataURL}},
+		}},
+	}
+
+	ids, err := uploadAttachments(context.Background(), "", "cookie-a", messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"file-a", "file-a"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("uploadAttachments() = %v, want %v", ids, want)
+	}
+
+	// 无附件时返回空列表
+	if ids, err = uploadAttachments(context.Background(), "", "cookie-a", messages[:1]); err != nil || ids == nil || len(ids) != 0 {
+		t.Errorf("uploadAttachments() = %v, %v, want an empty list", ids, err)
+	}
+
+	// 附件读取失败时返回错误
+	invalid := []model.Keyv[interface{}]{{"role": "user", "content": []interface{}{
+		map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": dataURL}},
+	}}}
+	if _, err = uploadAttachments(context.Background(), "", "cookie-a", invalid); err == nil {
+		t.Error("uploadAttachments() accepted a text file as an image")
+	}
+}
@@ -164,11 +164,11 @@ func (api *api) Completion(ctx *gin.Context) (err error) {
 		response.Error(ctx, -1, err)
 		return
 	}
-	ctx.Set(ginTokens, response.CalcTokens(newMessages))
+	ctx.Set(ginTokens, response.CalcTokens(completion.Model, newMessages))
 	ch, err := fetch(ctx.Request.Context(), api.env, proxied, newMessages,
 		options{
 			model:       completion.Model,
-			temperature: completion.Temperature,
+			temperature: completion.GetTemperature(0),
 			topP:        completion.TopP,
 			maxTokens:   completion.MaxTokens,
 		})
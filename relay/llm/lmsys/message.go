@@ -91,7 +91,7 @@ func waitResponse(ctx *gin.Context, chatResponse chan string, sse bool) (content
 		return
 	}
 
-	ctx.Set(vars.GinCompletionUsage, response.CalcUsageTokens(content, tokens))
+	ctx.Set(vars.GinCompletionUsage, response.CalcUsageTokens(common.GetGinCompletion(ctx).Model, content, tokens))
 	if !sse {
 		response.Response(ctx, Model, content)
 	} else {
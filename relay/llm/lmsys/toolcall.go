@@ -23,7 +23,7 @@ func toolChoice(ctx *gin.Context, env *env.Environment, proxies string, completi
 		ch, err := fetch(ctx.Request.Context(), env, proxies, message,
 			options{
 				model:       completion.Model,
-				temperature: completion.Temperature,
+				temperature: completion.GetTemperature(0),
 				topP:        completion.TopP,
 				maxTokens:   completion.MaxTokens,
 			})
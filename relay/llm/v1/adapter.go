@@ -22,6 +22,9 @@ var (
 	upKey  = "__custom-proxies__"
 	modKey = "__custom-model__"
 	tcKey  = "__custom-toolCall__"
+	ntKey  = "__custom-nativeToolCall__"
+	suKey  = "__custom-streamUsage__"
+	rfKey  = "__custom-responseFormat__"
 )
 
 type api struct {
@@ -51,6 +54,9 @@ func (*api) Match(ctx *gin.Context, model string) (ok bool, _ error) {
 			ctx.Set(upKey, it["proxied"] == "true")
 			ctx.Set(modKey, model[len(prefix)+1:])
 			ctx.Set(tcKey, it["tc"] == "true")
+			ctx.Set(ntKey, it["tc"] == "native")
+			ctx.Set(suKey, flag(it["stream-usage"], false))
+			ctx.Set(rfKey, flag(it["response-format"], false))
 			ok = true
 			return
 		}
@@ -58,6 +64,31 @@ func (*api) Match(ctx *gin.Context, model string) (ok bool, _ error) {
 	return
 }
 
+// 图片原样转发给上游，可在 custom-llm 中配置 vision: false 关闭
+func (*api) Vision(_ *gin.Context, model string) bool {
+	for _, it := range schema {
+		if prefix, o := it["prefix"].(string); o && strings.HasPrefix(model, prefix+"/") {
+			return flag(it["vision"], true)
+		}
+	}
+	return false
+}
+
+// 配置项可能是 yaml 布尔值或字符串，未配置时返回 def
+func flag(value interface{}, def bool) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		if v != "" {
+			return strings.EqualFold(v, "true")
+		}
+		return def
+	default:
+		return def
+	}
+}
+
 func (*api) Models() []model.Model {
 	return []model.Model{
 		{
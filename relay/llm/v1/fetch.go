@@ -24,8 +24,9 @@ func fetch(ctx *gin.Context, proxies, token string, completion model.Completion)
 		completion.TopP = 1
 	}
 
-	if completion.Temperature == 0 {
-		completion.Temperature = 0.7
+	if completion.Temperature == nil {
+		temperature := float32(0.7)
+		completion.Temperature = &temperature
 	}
 
 	if completion.MaxTokens == 0 {
@@ -34,17 +35,29 @@ func fetch(ctx *gin.Context, proxies, token string, completion model.Completion)
 
 	tokens := 0
 	for _, message := range completion.Messages {
-		tokens += response.CalcTokens(message.GetString("content"))
+		tokens += response.CalcTokens(completion.Model, message.GetString("content"))
 	}
-	ctx.Set(ginTokens, token)
+	ctx.Set(ginTokens, tokens)
 
 	completion.Stream = true
+	completion.StreamOptions = nil
+	// custom-llm 配置 stream-usage: true 时要求上游在流末尾返回真实用量，否则按本地估算
+	if ctx.GetBool(suKey) {
+		completion.StreamOptions = &model.StreamOptions{IncludeUsage: true}
+	}
 	completion.Model = ctx.GetString(modKey)
 	obj, err := toMap(completion)
 	if err != nil {
 		return nil, err
 	}
 
+	// 仅适配器使用的字段不发送给上游，严格兼容 openai 的服务会拒绝未知字段
+	delete(obj, "conversation_id")
+	delete(obj, "n")
+	if !ctx.GetBool(rfKey) {
+		delete(obj, "response_format")
+	}
+
 	if completion.TopK == 0 {
 		delete(obj, "top_k")
 	}
@@ -57,6 +70,9 @@ func fetch(ctx *gin.Context, proxies, token string, completion model.Completion)
 		JSONHeader().
 		Body(obj).
 		DoC(emit.Status(http.StatusOK), emit.IsSTREAM)
+	if err != nil && r != nil {
+		err = common.WithRetryAfter(err, r.Header)
+	}
 	return
 }
 
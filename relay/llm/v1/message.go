@@ -3,6 +3,7 @@ package v1
 import (
 	"bufio"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -55,7 +56,7 @@ func waitMessage(r *http.Response, cancel func(str string) bool) (content string
 			continue
 		}
 
-		if choice.FinishReason != nil && *choice.FinishReason == "stop" {
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
 			continue
 		}
 
@@ -86,7 +87,11 @@ func waitResponse(ctx *gin.Context, r *http.Response, sse bool) (content string)
 	toolId := common.GetGinToolValue(ctx).GetString("id")
 	toolId = toolcall.Query(toolId, completion.Tools)
 	var toolCall map[string]interface{}
+	var toolCalls []model.Keyv[interface{}]
 	htc := false
+	native := ctx.GetBool(ntKey)
+	var usage map[string]interface{}
+	created := time.Now().Unix()
 
 	scanner := bufio.NewScanner(r.Body)
 	for {
@@ -112,7 +117,7 @@ func waitResponse(ctx *gin.Context, r *http.Response, sse bool) (content string)
 				response.Event(ctx, "", raw)
 			}
 			content += raw
-			if htc && !sse {
+			if htc && !sse && toolCall != nil {
 				toolCall["args"] = content
 			}
 			break
@@ -125,6 +130,16 @@ func waitResponse(ctx *gin.Context, r *http.Response, sse bool) (content string)
 			continue
 		}
 
+		// 同一响应的所有数据块（含用量块）使用相同的 id 与 created
+		chat.Id = fmt.Sprintf("chatcmpl-%d", created)
+		chat.Created = created
+
+		// 用量可能在结束块中，也可能是 choices 为空的单独数据块；
+		// 上游的原始用量不转发，结束时统一输出归一化后的用量块
+		if chat.Usage != nil {
+			usage = chat.Usage
+			chat.Usage = nil
+		}
 		if len(chat.Choices) == 0 {
 			continue
 		}
@@ -137,7 +152,13 @@ func waitResponse(ctx *gin.Context, r *http.Response, sse bool) (content string)
 		if choice.Delta.ToolCalls != nil && len(choice.Delta.ToolCalls) > 0 {
 			htc = true
 			if sse {
-				response.Event(ctx, "", chat)
+				response.SSEChunk(ctx, chat)
+				continue
+			}
+
+			// 原生工具调用：按 index 合并增量
+			if native {
+				toolCalls = mergeToolCalls(toolCalls, choice.Delta.ToolCalls)
 				continue
 			}
 
@@ -152,13 +173,12 @@ func waitResponse(ctx *gin.Context, r *http.Response, sse bool) (content string)
 			continue
 		}
 
-		if choice.FinishReason != nil && *choice.FinishReason == "stop" {
-			if chat.Usage == nil {
-				chat.Usage = response.CalcUsageTokens(content, tokens)
-			}
-			ctx.Set(vars.GinCompletionUsage, chat.Usage)
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			finishReason := response.FinishReason(*choice.FinishReason)
+			chat.Choices[0].FinishReason = &finishReason
+			response.SetFinishReason(ctx, finishReason)
 			if sse {
-				response.Event(ctx, "", chat)
+				response.SSEChunk(ctx, chat)
 			}
 			continue
 		}
@@ -172,7 +192,7 @@ func waitResponse(ctx *gin.Context, r *http.Response, sse bool) (content string)
 			continue
 		}
 
-		if !htc && toolId != "-1" {
+		if !native && !htc && toolId != "-1" {
 			toolCall = map[string]interface{}{
 				"name": toolId,
 				"args": "",
@@ -182,20 +202,29 @@ func waitResponse(ctx *gin.Context, r *http.Response, sse bool) (content string)
 
 		choice.Delta.Content = raw
 		if sse && len(raw) > 0 {
-			response.Event(ctx, "", chat)
+			response.SSEChunk(ctx, chat)
 		}
 		content += raw
 	}
 
+	ctx.Set(vars.GinCompletionUsage, response.ResolveUsage(completion.Model, usage, content, tokens))
 	if toolCall != nil {
 		if !sse {
 			response.ToolCallResponse(ctx, Model, toolCall["name"].(string), toolCall["args"].(string))
 		} else {
-			response.SSEToolCallResponse(ctx, Model, toolCall["name"].(string), toolCall["args"].(string), time.Now().Unix())
+			response.SSEToolCallResponse(ctx, Model, toolCall["name"].(string), toolCall["args"].(string), created)
 		}
 		return
 	}
 
+	if len(toolCalls) > 0 && !sse {
+		for _, tc := range toolCalls {
+			delete(tc, "index")
+		}
+		response.ToolCallsResponse(ctx, Model, content, toolCalls)
+		return
+	}
+
 	if content == "" && response.NotSSEHeader(ctx) {
 		return
 	}
@@ -203,7 +232,56 @@ func waitResponse(ctx *gin.Context, r *http.Response, sse bool) (content string)
 	if !sse {
 		response.Response(ctx, Model, content)
 	} else {
+		response.SSEUsage(ctx, Model, created)
 		response.Event(ctx, "", "[DONE]")
 	}
 	return
 }
+
+func mergeToolCalls(toolCalls []model.Keyv[interface{}], deltas []model.Keyv[interface{}]) []model.Keyv[interface{}] {
+	for _, delta := range deltas {
+		index := toolIndex(delta)
+		var toolCall model.Keyv[interface{}]
+		for _, tc := range toolCalls {
+			if toolIndex(tc) == index {
+				toolCall = tc
+				break
+			}
+		}
+
+		if toolCall == nil {
+			toolCall = model.Keyv[interface{}]{
+				"index": index,
+				"type":  "function",
+				"function": map[string]interface{}{
+					"name":      "",
+					"arguments": "",
+				},
+			}
+			toolCalls = append(toolCalls, toolCall)
+		}
+
+		if id := delta.GetString("id"); id != "" {
+			toolCall["id"] = id
+		}
+
+		fn := toolCall.GetKeyv("function")
+		keyv := delta.GetKeyv("function")
+		if name := keyv.GetString("name"); name != "" {
+			fn["name"] = name
+		}
+		fn["arguments"] = fn.GetString("arguments") + keyv.GetString("arguments")
+	}
+	return toolCalls
+}
+
+func toolIndex(toolCall model.Keyv[interface{}]) int {
+	switch index := toolCall["index"].(type) {
+	case int:
+		return index
+	case float64:
+		return int(index)
+	default:
+		return 0
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"io"
 	"net/http"
 	"strings"
-	"time"
 
 	"chatgpt-adapter/core/cache"
 	"chatgpt-adapter/core/common"
@@ -56,8 +55,9 @@ func convertRequest(completion model.Completion, ident, token string) (buffer []
 	if completion.TopP == 0 {
 		completion.TopP = 0.4
 	}
-	if completion.Temperature == 0 {
-		completion.Temperature = 0.4
+	if completion.Temperature == nil {
+		temperature := float32(0.4)
+		completion.Temperature = &temperature
 	}
 
 	if len(completion.Messages) > 0 && completion.Messages[0].Is("role", "system") {
@@ -82,7 +82,7 @@ func convertRequest(completion model.Completion, ident, token string) (buffer []
 
 		return &ChatMessage_UserMessage{
 			Message:       content,
-			Token:         uint32(response.CalcTokens(message.GetString("content"))),
+			Token:         uint32(response.CalcTokens(completion.Model, message.GetString("content"))),
 			Role:          elseOf[uint32](message.Is("role", "assistant"), 2, 1),
 			UnknownField5: elseOf[uint32](message.Is("role", "assistant"), 0, 1),
 			UnknownField8: elseOf(pos == 1 || pos >= messageL, &ChatMessage_UserMessage_Unknown_Field8{
@@ -111,7 +111,7 @@ func convertRequest(completion model.Completion, ident, token string) (buffer []
 			MaxTokens:       uint32(completion.MaxTokens),
 			TopK:            uint32(completion.TopK),
 			TopP:            float64(completion.TopP),
-			Temperature:     float64(completion.Temperature),
+			Temperature:     float64(*completion.Temperature),
 			UnknownField7:   50,
 			PresencePenalty: 1.0,
 			Stop: []string{
@@ -254,7 +254,7 @@ func genToken(ctx context.Context, proxies, ident string) (token string, err err
 	}
 
 	token = jwtToken.Value
-	err = cacheManager.SetWithExpiration(ident, token, time.Hour)
+	err = cacheManager.SetValue(ident, token)
 	return
 }
 
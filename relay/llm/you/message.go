@@ -112,7 +112,7 @@ label:
 		return
 	}
 
-	ctx.Set(vars.GinCompletionUsage, response.CalcUsageTokens(content, tokens))
+	ctx.Set(vars.GinCompletionUsage, response.CalcUsageTokens(common.GetGinCompletion(ctx).Model, content, tokens))
 	if !sse {
 		response.Response(ctx, Model, content)
 	} else {
@@ -151,9 +151,9 @@ func mergeMessages(ctx *gin.Context, completion model.Completion) (fileMessage,
 			fileMessage = ""
 		}
 
-		tokens += response.CalcTokens(fileMessage)
-		tokens += response.CalcTokens(chat)
-		tokens += response.CalcTokens(query)
+		tokens += response.CalcTokens(completion.Model, fileMessage)
+		tokens += response.CalcTokens(completion.Model, chat)
+		tokens += response.CalcTokens(completion.Model, query)
 		return
 	}
 
@@ -178,7 +178,7 @@ func mergeMessages(ctx *gin.Context, completion model.Completion) (fileMessage,
 
 	convertRole, _ := response.ConvertRole(ctx, "assistant")
 	fileMessage = strings.Join(contents, "") + convertRole
-	tokens += response.CalcTokens(fileMessage)
+	tokens += response.CalcTokens(completion.Model, fileMessage)
 	if encodingLen(fileMessage) <= 12499 {
 		query = fileMessage
 		fileMessage = ""
@@ -2,6 +2,10 @@ package scan
 
 import (
 	_ "chatgpt-adapter/relay/alloc/bing"
+	_ "chatgpt-adapter/relay/alloc/blackbox"
 	_ "chatgpt-adapter/relay/alloc/coze"
+	_ "chatgpt-adapter/relay/alloc/cursor"
+	_ "chatgpt-adapter/relay/alloc/deepseek"
+	_ "chatgpt-adapter/relay/alloc/windsurf"
 	_ "chatgpt-adapter/relay/alloc/you"
 )